@@ -1,9 +1,9 @@
 package padchat
 
 import (
-	"fmt"
-	"log"
-	"strings"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
 	"sync"
 	"time"
 
@@ -12,72 +12,209 @@ import (
 	"github.com/json-iterator/go"
 )
 
+const (
+	// defaultEventWorkers 并发执行回调的 worker 数量
+	defaultEventWorkers = 4
+	// defaultEventQueueSize 用户事件队列长度, 队列满时阻塞读取
+	defaultEventQueueSize = 256
+)
+
 type Bot struct {
-	sync.RWMutex
-	ws            WSConn
-	retProcMap    *sync.Map
+	url           string
+	dialer        *websocket.Dialer
+	header        http.Header
+	tlsConfig     *tls.Config
+	compression   bool
+	readLimit     int64
+	pingInterval  time.Duration
+	pongTimeout   time.Duration
+	connMu        sync.RWMutex
+	ws            *WSConn
+	closed        bool
+	state         State
+	closeHandler  func(code int, text string) error
+	reconnect     *ReconnectPolicy
+	session       loginSession
+	sessionStore  SessionStore
+	pending       *pendingTable
+	events        chan *ServerData
+	done          chan struct{}
+	stopped       chan struct{}
+	shutdownOnce  sync.Once
+	loops         sync.WaitGroup
+	workers       sync.WaitGroup
+	handlers      sync.WaitGroup
+	delivery      *eventDelivery
+	dedup         DedupStore
+	contacts      *ContactStore
 	reqTimeout    time.Duration
-	onQRURL       func(string)
-	onScan        func(ScanResp)
-	onMsg         func(Msg)
-	onLogin       func()
-	onLoaded      func()
-	onContactSync func(Contact)
-	onWarn        func(string)
+	logger        Logger
+	subs          eventHandlers
+	eventChMu     sync.RWMutex
+	eventCh       chan Event
+	eventChClosed bool
+	publishing    sync.WaitGroup
 }
 
 // NewBot 乃万物之始
 // 新建 Bot 实例, 传入 PadChat 服务端地址
-func NewBot(url string) (*Bot, error) {
-	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+func NewBot(url string, opts ...BotOption) (*Bot, error) {
+	bot := newBot()
+	bot.url = url
+	for _, opt := range opts {
+		opt(bot)
+	}
+	conn, err := bot.dial()
 	if err != nil {
 		return nil, err
 	}
-	err = conn.WriteJSON(struct {
-		Type  string      `json:"type"`
-		Cmd   string      `json:"cmd"`
-		CmdID string      `json:"cmdId"`
-		Data  interface{} `json:"data"`
-	}{Type: "user", Cmd: "init", CmdID: uuid.New().String()})
-	if err != nil {
+	if err := bot.attach(conn); err != nil {
 		return nil, err
 	}
-	bot := newBot(conn)
-	go func() {
-		ticker := time.NewTicker(time.Millisecond * 500)
-		defer ticker.Stop()
-		var emptyCount int
-		for range ticker.C {
-			data := &ServerData{}
-			conn.ReadJSON(data)
-			switch data.Type {
-			case "userEvent":
-				bot.processUserEvent(data)
-			case "cmdRet":
-				proc, ok := bot.retProcMap.Load(data.CMDID)
-				if ok {
-					var resp CommandResp
-					jsoniter.Unmarshal(data.Data, &resp)
-					proc.(func(CommandResp))(resp)
-				}
-				bot.retProcMap.Delete(data.CMDID)
-			case "":
-				emptyCount++
-				if emptyCount > 10 {
-					bot.onWarn("empty event from server")
-				}
-			default:
-				fmt.Println(data.Type, data.Event, string(data.Data))
-				fmt.Println(strings.Repeat("*", 100))
+	bot.startEventWorkers()
+	return bot, nil
+}
+
+// NewBotFromConn 使用已建立的 ws 连接新建 Bot 实例, 一般用于测试
+// 由于没有服务端地址, 此方式创建的 Bot 无法断线重连, 连接相关的配置项也不会生效
+func NewBotFromConn(conn *websocket.Conn, opts ...BotOption) (*Bot, error) {
+	bot := newBot()
+	for _, opt := range opts {
+		opt(bot)
+	}
+	bot.reconnect = nil
+	if err := bot.attach(conn); err != nil {
+		return nil, err
+	}
+	bot.startEventWorkers()
+	return bot, nil
+}
+
+// dial 连接服务端
+func (bot *Bot) dial() (*websocket.Conn, error) {
+	dialer := *bot.dialer
+	if bot.tlsConfig != nil {
+		dialer.TLSClientConfig = bot.tlsConfig
+	}
+	if bot.compression {
+		dialer.EnableCompression = true
+	}
+	conn, _, err := dialer.Dial(bot.url, bot.header)
+	return conn, err
+}
+
+// attach 配置新建立的连接, 发送初始化指令并开始读取数据
+func (bot *Bot) attach(conn *websocket.Conn) error {
+	if bot.readLimit > 0 {
+		conn.SetReadLimit(bot.readLimit)
+	}
+	conn.EnableWriteCompression(bot.compression)
+	ws := &WSConn{Conn: conn}
+	id := uuid.New().String()
+	bot.pending.setInit(id)
+	err := ws.WriteJSON(WSReq{Type: "user", Cmd: "init", CmdID: id})
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	bot.connMu.Lock()
+	if bot.closed {
+		bot.connMu.Unlock()
+		conn.Close()
+		return ErrConnClosed
+	}
+	if bot.closeHandler != nil {
+		conn.SetCloseHandler(bot.closeHandler)
+	}
+	bot.ws = ws
+	bot.loops.Add(1)
+	bot.connMu.Unlock()
+	if bot.pingInterval > 0 {
+		timeout := bot.pongTimeout
+		if timeout <= 0 {
+			timeout = bot.pingInterval * 2
+		}
+		ws.setReadTimeout(timeout)
+		go func() {
+			err := ws.pingLoop(bot.pingInterval)
+			bot.logger.Debug("ping loop stopped", "error", err)
+		}()
+	}
+	bot.setState(StateConnected)
+	go bot.readLoop(ws)
+	return nil
+}
+
+// readLoop 阻塞读取服务端数据, 指令返回直接分发, 用户事件交由 eventWorker 处理
+// 连接断开时退出并按需重连
+func (bot *Bot) readLoop(ws *WSConn) {
+	defer bot.loops.Done()
+	var emptyCount int
+	for {
+		data := &ServerData{}
+		if err := ws.ReadJSON(data); err != nil {
+			bot.handleDisconnect(ws, err)
+			return
+		}
+		ws.touch()
+		bot.logger.Debug("recv frame", "type", data.Type, "event", data.Event,
+			"cmdId", data.CMDID, "size", len(data.Data))
+		switch data.Type {
+		case "userEvent":
+			bot.events <- data
+		case "cmdRet":
+			var resp CommandResp
+			jsoniter.Unmarshal(data.Data, &resp)
+			if !bot.pending.deliver(data.CMDID, resp) {
+				bot.logger.Debug("late command reply", "cmdId", data.CMDID)
+			}
+		case "":
+			emptyCount++
+			if emptyCount > 10 {
+				bot.watch(WarnEvent{Warn: "empty event from server"})
+				bot.notify(WarnEvent{Warn: "empty event from server"})
 			}
+		default:
+			bot.logger.Warn("unknown frame type", "type", data.Type, "event", data.Event,
+				"cmdId", data.CMDID, "size", len(data.Data))
+			bot.unknownEvent(data)
+		}
+	}
+}
+
+// startEventWorkers 启动处理用户事件的 worker
+// 只使用一个 worker 按接收顺序解析事件并更新状态, 如登录状态和群成员列表,
+// 回调由 delivery 的 worker 并发执行
+func (bot *Bot) startEventWorkers() {
+	bot.delivery.start(&bot.handlers, bot.runHandlers)
+	bot.workers.Add(1)
+	go func() {
+		defer bot.workers.Done()
+		for data := range bot.events {
+			bot.processUserEvent(data)
 		}
 	}()
-	return bot, nil
+}
+
+// conn 返回当前使用的 ws 连接
+func (bot *Bot) conn() *WSConn {
+	bot.connMu.RLock()
+	defer bot.connMu.RUnlock()
+	return bot.ws
 }
 
 // OnClose ws 断开回调
 func (bot *Bot) OnClose(f func(code int, text string) error) {
-	bot.ws.SetCloseHandler(f)
+	h := func(code int, text string) (err error) {
+		bot.guard(nil, func() {
+			err = f(code, text)
+		})
+		return err
+	}
+	bot.connMu.Lock()
+	defer bot.connMu.Unlock()
+	bot.closeHandler = h
+	bot.ws.SetCloseHandler(h)
 }
 
 func (bot *Bot) processUserEvent(data *ServerData) {
@@ -87,135 +224,128 @@ func (bot *Bot) processUserEvent(data *ServerData) {
 			URL string
 		}{}
 		jsoniter.Unmarshal(data.Data, url)
-		go func() {
-			bot.RLock()
-			defer bot.RUnlock()
-			bot.onQRURL(url.URL)
-		}()
+		bot.dispatch(QRURLEvent{URL: url.URL})
 	case "scan":
 		var scan ScanResp
 		jsoniter.Unmarshal(data.Data, &scan)
-		go func() {
-			bot.RLock()
-			defer bot.RUnlock()
-			bot.onScan(scan)
-		}()
+		bot.dispatch(ScanEvent{Scan: scan})
 	case "login":
-		go func() {
-			bot.RLock()
-			defer bot.RUnlock()
-			bot.onLogin()
-		}()
+		bot.setState(StateLoggedIn)
+		if bot.reconnectPolicy().ReLogin || bot.getSessionStore() != nil {
+			bot.handlers.Add(1)
+			go func() {
+				defer bot.handlers.Done()
+				bot.refreshSession()
+			}()
+		}
+		bot.dispatch(LoginEvent{})
 	case "push":
 		push := &PushResp{}
 		jsoniter.Unmarshal(data.Data, push)
 		for _, v := range push.List {
-			msgType := jsoniter.Get(v, "msg_type").ToInt()
-			switch msgType {
-			case 5:
-				var msg Msg
-				jsoniter.Unmarshal(v, &msg)
-				msg.MType = msg.SubType
-				go func() {
-					bot.RLock()
-					defer bot.RUnlock()
-					bot.onMsg(msg)
-				}()
-			case 2:
-				var contact Contact
-				jsoniter.Unmarshal(v, &contact)
-				go func() {
-					bot.RLock()
-					defer bot.RUnlock()
-					bot.onContactSync(contact)
-				}()
-			case 2048, 32768:
-			default:
-				fmt.Println(string(v))
-				fmt.Println(strings.Repeat("=", 100))
-			}
+			bot.processPush(v)
 		}
-
 	case "loaded":
-		go func() {
-			bot.RLock()
-			defer bot.RUnlock()
-			bot.onLoaded()
-		}()
+		bot.dispatch(LoadedEvent{})
 	case "logout":
-		log.Println("logout", string(data.Data))
-		bot.ws.Close()
-		bot.ws.CloseHandler()(501, "logout from server")
+		bot.logger.Info("logout", "data", string(data.Data))
+		ws := bot.markClosed()
+		bot.setState(StateDisconnected)
+		ws.Close()
+		ws.CloseHandler()(501, "logout from server")
 	case "warn":
 		err := &struct {
 			Error string
 		}{}
 		jsoniter.Unmarshal(data.Data, err)
-		bot.onWarn(err.Error)
+		bot.watch(WarnEvent{Warn: err.Error})
+		bot.notify(WarnEvent{Warn: err.Error})
 	default:
-		fmt.Println(data.Event, string(data.Data))
-		fmt.Println(strings.Repeat("~", 100))
+		bot.logger.Warn("unknown user event", "event", data.Event, "size", len(data.Data))
+		bot.unknownEvent(data)
 	}
 }
 
-func newBot(conn *websocket.Conn) *Bot {
-	return &Bot{
-		RWMutex: sync.RWMutex{},
-		ws: WSConn{
-			Mutex: sync.Mutex{},
-			Conn:  conn,
+// unknownEvent 将无法识别的服务端数据交给 OnUnknownEvent 回调
+func (bot *Bot) unknownEvent(data *ServerData) {
+	bot.dispatch(UnknownEvent{Data: *data})
+}
+
+func newBot() *Bot {
+	bot := &Bot{
+		dialer: &websocket.Dialer{
+			Proxy:            http.ProxyFromEnvironment,
+			HandshakeTimeout: 45 * time.Second,
 		},
-		reqTimeout:    time.Second * 30,
-		retProcMap:    &sync.Map{},
-		onQRURL:       func(string) {},
-		onScan:        func(ScanResp) {},
-		onMsg:         func(Msg) {},
-		onLogin:       func() {},
-		onLoaded:      func() {},
-		onContactSync: func(Contact) {},
+		reqTimeout: time.Second * 30,
+		logger:     NopLogger,
+		pending:    newPendingTable(),
+		contacts:   NewContactStore(),
+		events:     make(chan *ServerData, defaultEventQueueSize),
+		delivery:   newEventDelivery(DeliveryConfig{}, false),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	bot.contacts.onPanic = func(v interface{}, stack []byte) {
+		bot.handlerPanic(nil, v, stack)
 	}
+	return bot
 }
 
 // OnQRURL 收到二维码回调, 需在执行二维码登录前配置
-func (bot *Bot) OnQRURL(f func(string)) {
-	bot.Lock()
-	defer bot.Unlock()
-	bot.onQRURL = f
+// 所有 On 开头的方法均为添加回调, 返回取消注册的函数
+func (bot *Bot) OnQRURL(f func(string)) (unsubscribe func()) {
+	return bot.subs.qrURL.add(f)
 }
 
-// OnScan 二维码扫描回调
-func (bot *Bot) OnScan(f func(resp ScanResp)) {
-	bot.Lock()
-	defer bot.Unlock()
-	bot.onScan = f
+// OnScan 二维码扫描回调, 可通过 ScanResp.State 获取扫描状态
+func (bot *Bot) OnScan(f func(resp ScanResp)) (unsubscribe func()) {
+	return bot.subs.scan.add(f)
 }
 
 // OnMsg 微信接收消息回调
-func (bot *Bot) OnMsg(f func(msg Msg)) {
-	bot.Lock()
-	defer bot.Unlock()
-	bot.onMsg = f
+func (bot *Bot) OnMsg(f func(msg Msg)) (unsubscribe func()) {
+	return bot.subs.msg.add(f)
 }
 
 // OnLogin 登录成功回调
-func (bot *Bot) OnLogin(f func()) {
-	bot.Lock()
-	defer bot.Unlock()
-	bot.onLogin = f
+func (bot *Bot) OnLogin(f func()) (unsubscribe func()) {
+	return bot.subs.login.add(f)
 }
 
 // OnLoaded 联系人加载完成回调
-func (bot *Bot) OnLoaded(f func()) {
-	bot.Lock()
-	defer bot.Unlock()
-	bot.onLoaded = f
+func (bot *Bot) OnLoaded(f func()) (unsubscribe func()) {
+	return bot.subs.loaded.add(f)
 }
 
 // OnContactSync 联系人同步回调
-func (bot *Bot) OnContactSync(f func(contact Contact)) {
-	bot.Lock()
-	defer bot.Unlock()
-	bot.onContactSync = f
+func (bot *Bot) OnContactSync(f func(contact Contact)) (unsubscribe func()) {
+	return bot.subs.contactSync.add(f)
+}
+
+// OnDisconnect ws 连接异常断开回调, 主动关闭或退出登录时不会触发
+func (bot *Bot) OnDisconnect(f func(err error)) (unsubscribe func()) {
+	return bot.subs.disconnect.add(f)
+}
+
+// OnReconnect 断线重连成功回调, 需先通过 SetReconnect 开启断线重连
+func (bot *Bot) OnReconnect(f func()) (unsubscribe func()) {
+	return bot.subs.reconnect.add(f)
+}
+
+// OnUnknownEvent 收到无法识别的服务端数据或用户事件时回调
+func (bot *Bot) OnUnknownEvent(f func(data ServerData)) (unsubscribe func()) {
+	return bot.subs.unknownEvt.add(f)
+}
+
+// OnUnknownPush 收到无法识别 msg_type 的推送时回调, push 为推送的原始数据
+func (bot *Bot) OnUnknownPush(f func(push json.RawMessage)) (unsubscribe func()) {
+	return bot.subs.unknownPush.add(f)
+}
+
+// OnWarn 服务端警告回调, 回调在接收事件的协程中同步执行, 会阻塞后续事件的处理, 不应阻塞
+func (bot *Bot) OnWarn(f func(err string)) (unsubscribe func()) {
+	return bot.subs.warn.add(f)
 }
 
 // SetCommandTimeout 设置微信指令超时时间, 默认为 30 秒
@@ -223,11 +353,10 @@ func (bot *Bot) SetCommandTimeout(t time.Duration) {
 	bot.reqTimeout = t
 }
 
-func (bot *Bot) OnWarn(f func(err string)) {
-	bot.onWarn = f
-}
-
+// CloseWS 立即关闭 ws 连接, 如需等待回调执行完毕请使用 Shutdown
 func (bot *Bot) CloseWS() {
-	bot.ws.Close()
-	bot.ws.CloseHandler()(500, "close ws")
+	ws := bot.markClosed()
+	bot.setState(StateDisconnected)
+	ws.Close()
+	ws.CloseHandler()(500, "close ws")
 }
@@ -0,0 +1,474 @@
+package padchat_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuotoo/padchat"
+	"github.com/tuotoo/padchat/padchattest"
+)
+
+func newTestBot(t testing.TB, opts ...padchat.BotOption) (*padchat.Bot, *padchattest.Server) {
+	s := padchattest.NewServer()
+	t.Cleanup(s.Close)
+	bot, err := padchat.NewBot(s.URL, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		bot.Shutdown(context.Background())
+	})
+	return bot, s
+}
+
+// login 登录 bot 并等待 login 事件
+func login(t testing.TB, bot *padchat.Bot) {
+	logged := make(chan struct{})
+	unsubscribe := bot.OnLogin(func() {
+		close(logged)
+	})
+	defer unsubscribe()
+	require.True(t, bot.QRLogin().Success)
+	select {
+	case <-logged:
+	case <-time.After(time.Second):
+		t.Fatal("login event not received")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	bot, s := newTestBot(t)
+	_, err := bot.SendMsg(&padchat.SendMsgReq{ToUserName: "wxid_a", Content: "hi"})
+	assert.True(t, errors.Is(err, padchat.ErrNotLoggedIn))
+
+	login(t, bot)
+	s.Reply("sendMsg", padchat.SendMsgResp{MsgID: "1"})
+	resp, err := bot.SendMsg(&padchat.SendMsgReq{ToUserName: "wxid_a", Content: "hi"})
+	require.NoError(t, err)
+	assert.Equal(t, "1", resp.MsgID)
+	req, ok := s.WaitRequest("sendMsg", time.Second)
+	require.True(t, ok)
+	var sent padchat.SendMsgReq
+	require.NoError(t, req.Bind(&sent))
+	assert.Equal(t, "wxid_a", sent.ToUserName)
+
+	s.Handle("setRemark", func(padchattest.Request) padchattest.Reply {
+		return padchattest.Fail("no such user")
+	})
+	_, err = bot.SetRemark("wxid_a", "a")
+	var e *padchat.Error
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, "setRemark", e.Cmd)
+	assert.Equal(t, "no such user", e.Msg)
+
+	s.Reply("addLabel", padchat.MsgAndStatus{Status: -1, Message: "exists"})
+	_, err = bot.AddLabel("a")
+	assert.True(t, errors.Is(err, padchat.ErrServerStatus))
+}
+
+func TestCommandCtx(t *testing.T) {
+	bot, s := newTestBot(t, padchat.WithCommandTimeout(50*time.Millisecond))
+	s.Handle("syncMsg", func(padchattest.Request) padchattest.Reply {
+		return padchattest.Reply{NoReply: true}
+	})
+	_, err := bot.SyncMsgCtx(context.Background())
+	assert.True(t, errors.Is(err, padchat.ErrTimeout))
+	assert.Equal(t, "timeout", bot.SyncMsg().Msg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err = bot.SyncMsgCtx(ctx)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = bot.SyncMsgCtx(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestUserEvents(t *testing.T) {
+	bot, s := newTestBot(t)
+	qr := make(chan string, 1)
+	scan := make(chan padchat.ScanResp, 1)
+	msg := make(chan padchat.Msg, 1)
+	contact := make(chan padchat.Contact, 1)
+	unknown := make(chan json.RawMessage, 1)
+	bot.OnQRURL(func(url string) { qr <- url })
+	bot.OnScan(func(resp padchat.ScanResp) { scan <- resp })
+	bot.OnMsg(func(m padchat.Msg) { msg <- m })
+	bot.OnContactSync(func(c padchat.Contact) { contact <- c })
+	bot.OnUnknownPush(func(raw json.RawMessage) { unknown <- raw })
+
+	require.NoError(t, s.Emit(
+		padchattest.QRCodeEvent("http://weixin.qq.com/x/a"),
+		padchattest.ScanEvent(padchat.ScanResp{Status: 1}),
+		padchattest.PushEvent(
+			padchattest.MsgPush(padchat.Msg{FromUser: "wxid_a", SubType: 1}),
+			padchattest.ContactPush(padchat.Contact{UserName: "wxid_b"}),
+			map[string]interface{}{"msg_type": 99},
+		),
+	))
+	assert.Equal(t, "http://weixin.qq.com/x/a", <-qr)
+	assert.Equal(t, 1, (<-scan).Status)
+	m := <-msg
+	assert.Equal(t, "wxid_a", m.FromUser)
+	assert.Equal(t, 1, m.MType)
+	assert.Equal(t, "wxid_b", (<-contact).UserName)
+	assert.Contains(t, string(<-unknown), "99")
+}
+
+func TestReconnect(t *testing.T) {
+	bot, s := newTestBot(t, padchat.WithReconnect(&padchat.ReconnectPolicy{
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 10 * time.Millisecond,
+	}))
+	disconnected := make(chan error, 1)
+	reconnected := make(chan struct{}, 1)
+	bot.OnDisconnect(func(err error) { disconnected <- err })
+	bot.OnReconnect(func() { reconnected <- struct{}{} })
+	require.True(t, s.WaitConn(time.Second))
+	s.DropConns()
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("disconnect not detected")
+	}
+	select {
+	case <-reconnected:
+	case <-time.After(time.Second):
+		t.Fatal("not reconnected")
+	}
+	assert.True(t, bot.SyncMsg().Success)
+}
+
+func TestReconnectReLogin(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		tokenReply padchattest.Reply
+		want       []string
+	}{
+		{"token", padchattest.OK(nil, padchattest.LoginEvent()), []string{"token"}},
+		{"fallback", padchattest.Fail("token expired"), []string{"token", "request"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			bot, s := newTestBot(t, padchat.WithReconnect(&padchat.ReconnectPolicy{
+				ReLogin:    true,
+				MinBackoff: 10 * time.Millisecond,
+				MaxBackoff: 10 * time.Millisecond,
+			}))
+			var mu sync.Mutex
+			var loginTypes []string
+			s.Handle("login", func(req padchattest.Request) padchattest.Reply {
+				var data padchat.LoginReq
+				req.Bind(&data)
+				mu.Lock()
+				loginTypes = append(loginTypes, data.LoginType)
+				mu.Unlock()
+				if data.LoginType == "token" {
+					return tc.tokenReply
+				}
+				return padchattest.OK(nil, padchattest.LoginEvent())
+			})
+			s.Reply("getWxData", map[string]string{"wx_data": "62"})
+			s.Reply("getLoginToken", padchat.LoginTokenResp{Token: "t", Uin: 1})
+			reconnected := make(chan struct{}, 1)
+			bot.OnReconnect(func() { reconnected <- struct{}{} })
+
+			store := padchat.NewMemorySessionStore()
+			_, err := bot.AutoLogin(store)
+			require.NoError(t, err)
+			// 等待登录凭据缓存完成后再断开连接
+			deadline := time.Now().Add(time.Second)
+			for {
+				saved, err := store.Load()
+				require.NoError(t, err)
+				if saved != nil {
+					break
+				}
+				require.True(t, time.Now().Before(deadline), "session not cached")
+				time.Sleep(10 * time.Millisecond)
+			}
+			mu.Lock()
+			loginTypes = nil
+			mu.Unlock()
+
+			s.DropConns()
+			select {
+			case <-reconnected:
+			case <-time.After(2 * time.Second):
+				t.Fatal("not reconnected")
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, tc.want, loginTypes)
+			for _, req := range s.Requests("login") {
+				var data padchat.LoginReq
+				req.Bind(&data)
+				if data.LoginType != "qrcode" {
+					assert.Equal(t, "62", data.WXData)
+					assert.Equal(t, "t", data.Token)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCommandRoundTrip(b *testing.B) {
+	bot, _ := newTestBot(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if resp := bot.SyncMsg(); !resp.Success {
+			b.Fatal(resp.Msg)
+		}
+	}
+}
+
+func BenchmarkPushBurst(b *testing.B) {
+	const burst = 500
+	bot, s := newTestBot(b)
+	var wg sync.WaitGroup
+	bot.OnMsg(func(padchat.Msg) {
+		wg.Done()
+	})
+	event := padchattest.PushEvent(padchattest.MsgPush(padchat.Msg{FromUser: "wxid_a", SubType: 1}))
+	events := make([]padchattest.Event, burst)
+	for i := range events {
+		events[i] = event
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wg.Add(burst)
+		if err := s.Emit(events...); err != nil {
+			b.Fatal(err)
+		}
+		wg.Wait()
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*burst), "ns/push")
+}
+
+func TestState(t *testing.T) {
+	bot, _ := newTestBot(t)
+	assert.Equal(t, padchat.StateConnected, bot.State())
+	login(t, bot)
+	assert.Equal(t, padchat.StateLoggedIn, bot.State())
+	bot.CloseWS()
+	assert.Equal(t, padchat.StateDisconnected, bot.State())
+}
+
+func TestShutdown(t *testing.T) {
+	bot, s := newTestBot(t)
+	s.Handle("syncMsg", func(padchattest.Request) padchattest.Reply {
+		return padchattest.Reply{NoReply: true}
+	})
+	pending := make(chan error, 1)
+	go func() {
+		_, err := bot.SyncMsgCtx(context.Background())
+		pending <- err
+	}()
+	_, ok := s.WaitRequest("syncMsg", time.Second)
+	require.True(t, ok)
+
+	var handled int32
+	release := make(chan struct{})
+	bot.OnMsg(func(padchat.Msg) {
+		<-release
+		atomic.StoreInt32(&handled, 1)
+	})
+	require.NoError(t, s.PushMsg(padchat.Msg{FromUser: "wxid_a"}))
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, bot.Shutdown(ctx))
+	assert.True(t, errors.Is(<-pending, padchat.ErrConnClosed))
+	close(release)
+	require.NoError(t, bot.Shutdown(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&handled))
+	assert.NoError(t, bot.Shutdown(context.Background()))
+	assert.Equal(t, padchat.StateDisconnected, bot.State())
+	_, err := bot.SyncMsgCtx(context.Background())
+	assert.True(t, errors.Is(err, padchat.ErrConnClosed))
+}
+
+func TestHeartbeat(t *testing.T) {
+	s := padchattest.NewServer()
+	defer s.Close()
+	s.IgnorePing(true)
+	bot, err := padchat.NewBot(s.URL,
+		padchat.WithPingInterval(20*time.Millisecond),
+		padchat.WithPongTimeout(60*time.Millisecond))
+	require.NoError(t, err)
+	defer bot.Shutdown(context.Background())
+	changed := make(chan padchat.State, 4)
+	bot.OnStateChange(func(from, to padchat.State) { changed <- to })
+	select {
+	case state := <-changed:
+		assert.Equal(t, padchat.StateDisconnected, state)
+	case <-time.After(time.Second):
+		t.Fatal("dead connection not detected")
+	}
+}
+
+func TestEventBus(t *testing.T) {
+	bot, s := newTestBot(t)
+	events := bot.Events()
+	first := make(chan padchat.Msg, 2)
+	second := make(chan padchat.Msg, 2)
+	unsubscribeFirst := bot.OnMsg(func(m padchat.Msg) { first <- m })
+	unsubscribe := bot.OnMsg(func(m padchat.Msg) { second <- m })
+
+	require.NoError(t, s.PushMsg(padchat.Msg{FromUser: "wxid_a"}))
+	assert.Equal(t, "wxid_a", (<-first).FromUser)
+	assert.Equal(t, "wxid_a", (<-second).FromUser)
+
+	unsubscribe()
+	unsubscribe()
+	require.NoError(t, s.PushMsg(padchat.Msg{FromUser: "wxid_b"}))
+	assert.Equal(t, "wxid_b", (<-first).FromUser)
+	select {
+	case <-second:
+		t.Fatal("unsubscribed handler called")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	var msgs []string
+	timeout := time.After(time.Second)
+	for len(msgs) < 2 {
+		select {
+		case e := <-events:
+			if e, ok := e.(padchat.MsgEvent); ok {
+				msgs = append(msgs, e.Msg.FromUser)
+			}
+		case <-timeout:
+			t.Fatal("events not received")
+		}
+	}
+	assert.Equal(t, []string{"wxid_a", "wxid_b"}, msgs)
+
+	// Events 按接收顺序收到事件
+	unsubscribeFirst()
+	const n = 20
+	frames := []padchattest.Event{padchattest.QRCodeEvent("qr1"), padchattest.LoginEvent()}
+	for i := 0; i < n; i++ {
+		frames = append(frames, padchattest.PushEvent(padchattest.MsgPush(padchat.Msg{
+			FromUser: "wxid_a",
+			MsgID:    strconv.Itoa(i),
+		})))
+	}
+	require.NoError(t, s.Emit(frames...))
+	want := []string{"qrcode", "login"}
+	for i := 0; i < n; i++ {
+		want = append(want, strconv.Itoa(i))
+	}
+	var got []string
+	for len(got) < len(want) {
+		select {
+		case e := <-events:
+			switch e := e.(type) {
+			case padchat.QRURLEvent:
+				got = append(got, "qrcode")
+			case padchat.LoginEvent:
+				got = append(got, "login")
+			case padchat.MsgEvent:
+				got = append(got, e.Msg.MsgID)
+			}
+		case <-timeout:
+			t.Fatal("events not received")
+		}
+	}
+	assert.Equal(t, want, got)
+
+	require.NoError(t, bot.Shutdown(context.Background()))
+	for range events {
+	}
+}
+
+func TestEventsFull(t *testing.T) {
+	bot, s := newTestBot(t)
+	bot.Events()
+	const n = 300
+	events := make([]padchattest.Event, n)
+	for i := range events {
+		events[i] = padchattest.LoadedEvent()
+	}
+	require.NoError(t, s.Emit(events...))
+	// 等待 channel 写满, 之后每次读取都重新调用 Events
+	time.Sleep(100 * time.Millisecond)
+	timeout := time.After(5 * time.Second)
+	for loaded := 0; loaded < n; {
+		select {
+		case e := <-bot.Events():
+			if _, ok := e.(padchat.LoadedEvent); ok {
+				loaded++
+			}
+		case <-timeout:
+			t.Fatalf("got %d loaded events, want %d", loaded, n)
+		}
+	}
+}
+
+func TestHandlerPanic(t *testing.T) {
+	bot, s := newTestBot(t)
+	panics := make(chan padchat.HandlerPanicEvent, 2)
+	bot.OnHandlerPanic(func(e padchat.HandlerPanicEvent) { panics <- e })
+	msg := make(chan padchat.Msg, 1)
+	bot.OnMsg(func(padchat.Msg) { panic("boom") })
+	bot.OnMsg(func(m padchat.Msg) { msg <- m })
+
+	require.NoError(t, s.Emit(padchattest.WarnEvent("no handler")))
+	require.NoError(t, s.PushMsg(padchat.Msg{FromUser: "wxid_a"}))
+	assert.Equal(t, "wxid_a", (<-msg).FromUser)
+	p := <-panics
+	assert.Equal(t, "boom", p.Value)
+	assert.Contains(t, string(p.Stack), "TestHandlerPanic")
+	assert.Equal(t, "wxid_a", p.Event.(padchat.MsgEvent).Msg.FromUser)
+
+	bot.OnWarn(func(string) { panic("warn") })
+	require.NoError(t, s.Emit(padchattest.WarnEvent("boom")))
+	assert.Equal(t, "warn", (<-panics).Value)
+	assert.True(t, bot.SyncMsg().Success)
+}
+
+func TestNilDialer(t *testing.T) {
+	// WithDialer(nil) 使用默认的 Dialer
+	bot, _ := newTestBot(t, padchat.WithDialer(nil))
+	login(t, bot)
+	assert.Equal(t, padchat.StateLoggedIn, bot.State())
+}
+
+func TestEventWorkers(t *testing.T) {
+	bot, s := newTestBot(t)
+	var active, peak, handled int32
+	release := make(chan struct{})
+	bot.OnMsg(func(padchat.Msg) {
+		n := atomic.AddInt32(&active, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&active, -1)
+		atomic.AddInt32(&handled, 1)
+	})
+	msgs := make([]padchat.Msg, 20)
+	for i := range msgs {
+		msgs[i] = padchat.Msg{FromUser: "wxid_a", MsgID: strconv.Itoa(i)}
+	}
+	require.NoError(t, s.PushMsg(msgs...))
+
+	// 回调阻塞时最多同时执行 4 个, 其余事件在队列中等待
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&peak))
+	close(release)
+	require.NoError(t, bot.Shutdown(context.Background()))
+	assert.Equal(t, int32(20), atomic.LoadInt32(&handled))
+}
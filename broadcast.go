@@ -0,0 +1,278 @@
+package padchat
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"text/template"
+
+	"github.com/google/uuid"
+)
+
+// Selector 从联系人缓存中选择群发的接收者
+type Selector func(c Contact) bool
+
+// SelectKind 选择指定类型的联系人, 如 ContactFriend 或 ContactRoom
+func SelectKind(kind ContactKind) Selector {
+	return func(c Contact) bool {
+		return c.Kind() == kind
+	}
+}
+
+// SelectLabel 选择带有指定标签的联系人
+func SelectLabel(labelID int) Selector {
+	return func(c Contact) bool {
+		for _, id := range c.LabelIDs() {
+			if id == labelID {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// SelectRoomMembers 选择 roomID 的群成员, 只包括联系人缓存中的联系人
+func SelectRoomMembers(s *ContactStore, roomID string) Selector {
+	members := make(map[string]bool)
+	for _, m := range s.RoomMembers(roomID) {
+		members[m.UserName] = true
+	}
+	return func(c Contact) bool {
+		return members[c.UserName]
+	}
+}
+
+// SelectSex 选择指定性别的联系人, 1 为男, 2 为女
+func SelectSex(sex int) Selector {
+	return func(c Contact) bool {
+		return c.Sex == sex
+	}
+}
+
+// SelectCity 选择指定城市的联系人
+func SelectCity(city string) Selector {
+	return func(c Contact) bool {
+		return c.City == city
+	}
+}
+
+// SelectAll 选择满足所有条件的联系人
+func SelectAll(selectors ...Selector) Selector {
+	return func(c Contact) bool {
+		for _, s := range selectors {
+			if !s(c) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// SelectAny 选择满足任一条件的联系人
+func SelectAny(selectors ...Selector) Selector {
+	return func(c Contact) bool {
+		for _, s := range selectors {
+			if s(c) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Broadcast 群发任务
+type Broadcast struct {
+	// ID 任务 ID, 为空时使用 Checkpoint 中的 ID, 都为空时自动生成, 会作为 Tag 出现在 Outbox 的发送结果中
+	ID string
+	// Recipients 接收者 ID
+	Recipients []string
+	// Select 从联系人缓存中选择接收者, 与 Recipients 合并
+	Select Selector
+	// Template 消息内容, 使用 text/template 语法, 可使用 BroadcastVars 中的字段,
+	// 如 `{{.Name}} 你好`
+	Template string
+	// Vars 每个接收者的自定义变量, 按接收者 ID 保存, 在模板中通过 {{.Vars.key}} 使用
+	Vars map[string]map[string]string
+	// Priority 消息优先级, 为零值时使用 PriorityLow, 避免影响其他消息
+	Priority Priority
+	// Checkpoint 之前中断的任务进度, 其中已发送成功的接收者不会再次发送.
+	// 设置了 Store 时, 中断前已加入队列的消息由 NewOutbox 恢复, 继续任务时不会重复加入
+	Checkpoint *BroadcastCheckpoint
+}
+
+// BroadcastVars 渲染模板时使用的变量
+type BroadcastVars struct {
+	UserName string
+	NickName string
+	Remark   string
+	// Name 备注, 没有备注时为昵称
+	Name string
+	Vars map[string]string
+}
+
+// BroadcastCheckpoint 群发进度, 可保存后用于继续中断的任务
+type BroadcastCheckpoint struct {
+	ID string `json:"id"`
+	// Sent 已发送成功的接收者
+	Sent []string `json:"sent"`
+}
+
+// BroadcastProgress 每个接收者的发送结果
+type BroadcastProgress struct {
+	UserName string
+	Resp     *SendMsgResp
+	Err      error
+	// Done 已处理的接收者数量, 包括失败的接收者
+	Done int
+	// Failed 发送失败的接收者数量
+	Failed int
+	// Total 本次需要发送的接收者数量, 不包括 Checkpoint 中已发送的接收者
+	Total int
+	// Checkpoint 当前进度
+	Checkpoint BroadcastCheckpoint
+}
+
+// errEmptyTemplate 群发任务没有设置消息内容
+var errEmptyTemplate = errors.New("padchat: broadcast template is empty")
+
+// Broadcast 将每个接收者的消息加入 Outbox, 返回接收发送进度的 channel, 进度按发送结果产生的顺序,
+// 所有接收者处理完后关闭. 消息 ID 为 "任务 ID:接收者 ID", Tag 为任务 ID.
+// ctx 结束时移除尚未发送的消息, Outbox 或 Bot 关闭时停止等待, 最后一次进度中的 Checkpoint 可用于继续发送
+func (o *Outbox) Broadcast(ctx context.Context, b Broadcast) (<-chan BroadcastProgress, error) {
+	if b.Template == "" {
+		return nil, errEmptyTemplate
+	}
+	tmpl, err := template.New("broadcast").Option("missingkey=zero").Parse(b.Template)
+	if err != nil {
+		return nil, err
+	}
+	if b.ID == "" && b.Checkpoint != nil {
+		b.ID = b.Checkpoint.ID
+	}
+	if b.ID == "" {
+		b.ID = uuid.New().String()
+	}
+	if b.Priority == PriorityNormal {
+		b.Priority = PriorityLow
+	}
+	cp := BroadcastCheckpoint{ID: b.ID}
+	sent := make(map[string]bool)
+	if b.Checkpoint != nil {
+		cp.Sent = append(cp.Sent, b.Checkpoint.Sent...)
+		for _, id := range cp.Sent {
+			sent[id] = true
+		}
+	}
+
+	contacts := o.bot.Contacts()
+	var recipients []string
+	seen := make(map[string]bool)
+	add := func(id string) {
+		if id != "" && !seen[id] && !sent[id] {
+			seen[id] = true
+			recipients = append(recipients, id)
+		}
+	}
+	for _, id := range b.Recipients {
+		add(id)
+	}
+	if b.Select != nil {
+		for _, c := range contacts.Filter(b.Select) {
+			add(c.UserName)
+		}
+	}
+
+	// 先渲染所有消息, 模板错误时不发送任何消息
+	msgs := make([]OutMsg, len(recipients))
+	for i, id := range recipients {
+		vars := BroadcastVars{UserName: id, Vars: b.Vars[id]}
+		if c, ok := contacts.Get(id); ok {
+			vars.NickName = c.NickName
+			vars.Remark = c.Remark
+		}
+		vars.Name = vars.Remark
+		if vars.Name == "" {
+			vars.Name = vars.NickName
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, vars); err != nil {
+			return nil, err
+		}
+		msgs[i] = OutText(id, buf.String())
+		msgs[i].ID = b.ID + ":" + id
+		msgs[i].Priority = b.Priority
+		msgs[i].Tag = b.ID
+	}
+
+	// 加入队列前注册回调, 避免遗漏很快产生的发送结果
+	want := make(map[string]bool, len(msgs))
+	for _, m := range msgs {
+		want[m.ID] = true
+	}
+	results := make(chan OutResult, len(msgs))
+	unsubscribe := o.OnResult(func(r OutResult) {
+		if r.Msg.Tag == b.ID && want[r.Msg.ID] {
+			select {
+			case results <- r:
+			default:
+			}
+		}
+	})
+	queued := make(map[string]bool, len(msgs))
+	var failed []OutResult
+	for _, m := range msgs {
+		if ctx.Err() != nil {
+			break
+		}
+		if _, err := o.Enqueue(m); err != nil {
+			failed = append(failed, OutResult{Msg: m, Err: err})
+			continue
+		}
+		queued[m.ID] = true
+	}
+
+	ch := make(chan BroadcastProgress, len(msgs))
+	go func() {
+		defer close(ch)
+		defer unsubscribe()
+		p := BroadcastProgress{Total: len(msgs)}
+		report := func(r OutResult) {
+			p.UserName, p.Resp, p.Err = r.Msg.Req.ToUserName, r.Resp, r.Err
+			p.Done++
+			if r.Err != nil {
+				p.Failed++
+			} else {
+				cp.Sent = append(cp.Sent, r.Msg.Req.ToUserName)
+			}
+			p.Checkpoint = BroadcastCheckpoint{ID: cp.ID, Sent: append([]string(nil), cp.Sent...)}
+			ch <- p
+		}
+		for _, r := range failed {
+			report(r)
+		}
+		done := ctx.Done()
+		for len(queued) > 0 {
+			select {
+			case r := <-results:
+				delete(queued, r.Msg.ID)
+				report(r)
+			case <-done:
+				// 移除尚未发送的消息, 继续等待正在发送的消息的结果
+				for _, id := range o.remove(queued) {
+					delete(queued, id)
+				}
+				done = nil
+			case <-o.done:
+				for {
+					select {
+					case r := <-results:
+						report(r)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
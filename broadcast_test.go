@@ -0,0 +1,172 @@
+package padchat_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuotoo/padchat"
+	"github.com/tuotoo/padchat/padchattest"
+)
+
+func broadcastContacts() *padchat.ContactStore {
+	s := padchat.NewContactStore()
+	s.Put(padchat.Contact{UserName: "f1", NickName: "Alice", Label: "1", Sex: 2, City: "Shanghai"})
+	s.Put(padchat.Contact{UserName: "f2", NickName: "Bob", Remark: "Bobby", Label: "1,2", Sex: 1, City: "Beijing"})
+	s.Put(padchat.Contact{UserName: "f3", NickName: "Carol", Label: "2", Sex: 2, City: "Beijing"})
+	s.Put(padchat.Contact{UserName: "1@chatroom", Member: `["f1","f3","stranger"]`})
+	return s
+}
+
+func TestSelector(t *testing.T) {
+	s := broadcastContacts()
+	filter := func(sel padchat.Selector) []string {
+		return userNames(s.Filter(sel))
+	}
+	assert.Equal(t, []string{"f1", "f2"}, filter(padchat.SelectLabel(1)))
+	assert.Equal(t, []string{"f3"}, filter(padchat.SelectAll(padchat.SelectSex(2), padchat.SelectCity("Beijing"))))
+	assert.Equal(t, []string{"f1", "f3"}, filter(padchat.SelectRoomMembers(s, "1@chatroom")))
+	assert.Equal(t, []string{"1@chatroom", "f2", "f3"},
+		filter(padchat.SelectAny(padchat.SelectKind(padchat.ContactRoom), padchat.SelectLabel(2))))
+}
+
+func TestBroadcast(t *testing.T) {
+	ctx := context.Background()
+	bot, s := newTestBot(t)
+	login(t, bot)
+	for _, c := range broadcastContacts().All() {
+		bot.Contacts().Put(c)
+	}
+	s.Handle("sendMsg", func(req padchattest.Request) padchattest.Reply {
+		var data padchat.SendMsgReq
+		req.Bind(&data)
+		if data.ToUserName == "x" {
+			return padchattest.Fail("not friend")
+		}
+		return padchattest.OK(padchat.SendMsgResp{MsgID: data.ToUserName})
+	})
+	o, err := padchat.NewOutbox(bot, padchat.OutboxConfig{})
+	require.NoError(t, err)
+	defer o.Close(ctx)
+
+	_, err = o.Broadcast(ctx, padchat.Broadcast{Recipients: []string{"f1"}})
+	assert.Error(t, err)
+	_, err = o.Broadcast(ctx, padchat.Broadcast{Recipients: []string{"f1"}, Template: "{{.Name"})
+	assert.Error(t, err)
+
+	ch, err := o.Broadcast(ctx, padchat.Broadcast{
+		ID:         "notice",
+		Recipients: []string{"f1", "x", "f1"},
+		Select:     padchat.SelectLabel(2),
+		Template:   "{{.Name}}:{{.Vars.code}}",
+		Vars:       map[string]map[string]string{"f3": {"code": "c3"}},
+	})
+	require.NoError(t, err)
+	var progress []padchat.BroadcastProgress
+	for p := range ch {
+		progress = append(progress, p)
+	}
+	require.Len(t, progress, 4)
+	last := progress[3]
+	assert.Equal(t, 4, last.Total)
+	assert.Equal(t, 4, last.Done)
+	assert.Equal(t, 1, last.Failed)
+	assert.Equal(t, "x", progress[1].UserName)
+	assert.Error(t, progress[1].Err)
+	assert.Equal(t, "f3", last.Resp.MsgID)
+	assert.Equal(t, padchat.BroadcastCheckpoint{ID: "notice", Sent: []string{"f1", "f2", "f3"}}, last.Checkpoint)
+	assert.Equal(t, []string{"f1:Alice:", "x::", "f2:Bobby:", "f3:Carol:c3"}, sentTo(s))
+
+	// 从 checkpoint 继续时只发送未成功的接收者
+	ch, err = o.Broadcast(ctx, padchat.Broadcast{
+		Recipients: []string{"f1", "f2", "f3"},
+		Template:   "again",
+		Checkpoint: &padchat.BroadcastCheckpoint{ID: "notice", Sent: []string{"f1", "f2"}},
+	})
+	require.NoError(t, err)
+	p := <-ch
+	assert.Equal(t, 1, p.Total)
+	assert.Equal(t, "f3", p.UserName)
+	assert.Equal(t, []string{"f1", "f2", "f3"}, p.Checkpoint.Sent)
+	_, ok := <-ch
+	assert.False(t, ok)
+
+	// ctx 已结束时不发送
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	ch, err = o.Broadcast(canceled, padchat.Broadcast{Recipients: []string{"f1"}, Template: "no"})
+	require.NoError(t, err)
+	_, ok = <-ch
+	assert.False(t, ok)
+	assert.Len(t, sentTo(s), 5)
+}
+
+func TestBroadcastRetry(t *testing.T) {
+	ctx := context.Background()
+	bot, s := newTestBot(t, padchat.WithCommandTimeout(100*time.Millisecond))
+	login(t, bot)
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	s.Handle("sendMsg", func(req padchattest.Request) padchattest.Reply {
+		var data padchat.SendMsgReq
+		req.Bind(&data)
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[data.ToUserName]++
+		// a 第一次发送超时
+		if data.ToUserName == "a" && attempts["a"] == 1 {
+			return padchattest.Reply{NoReply: true}
+		}
+		return padchattest.OK(padchat.SendMsgResp{MsgID: data.ToUserName})
+	})
+	o, err := padchat.NewOutbox(bot, padchat.OutboxConfig{MaxRetries: 1, MinBackoff: 300 * time.Millisecond})
+	require.NoError(t, err)
+	defer o.Close(ctx)
+
+	// 等待重试的消息不阻塞其他接收者
+	ch, err := o.Broadcast(ctx, padchat.Broadcast{Recipients: []string{"a", "b", "c"}, Template: "hi"})
+	require.NoError(t, err)
+	var order []string
+	for p := range ch {
+		require.NoError(t, p.Err)
+		order = append(order, p.UserName)
+	}
+	assert.Equal(t, []string{"b", "c", "a"}, order)
+}
+
+func TestBroadcastResume(t *testing.T) {
+	ctx := context.Background()
+	bot, s := newTestBot(t)
+	// 重启前已加入队列的消息保存在 Store 中
+	store := padchat.NewMemoryOutboxStore()
+	m := padchat.OutText("f3", "hi")
+	m.ID, m.Tag, m.Priority = "notice:f3", "notice", padchat.PriorityLow
+	require.NoError(t, store.Save(m))
+	o, err := padchat.NewOutbox(bot, padchat.OutboxConfig{
+		MaxRetries: 3,
+		MinBackoff: 50 * time.Millisecond,
+		Store:      store,
+	})
+	require.NoError(t, err)
+	defer o.Close(ctx)
+
+	ch, err := o.Broadcast(ctx, padchat.Broadcast{
+		Recipients: []string{"f1", "f2", "f3", "f4"},
+		Template:   "hi",
+		Checkpoint: &padchat.BroadcastCheckpoint{ID: "notice", Sent: []string{"f1", "f2"}},
+	})
+	require.NoError(t, err)
+	login(t, bot)
+	var last padchat.BroadcastProgress
+	for p := range ch {
+		require.NoError(t, p.Err)
+		last = p
+	}
+	assert.Equal(t, 2, last.Done)
+	assert.ElementsMatch(t, []string{"f1", "f2", "f3", "f4"}, last.Checkpoint.Sent)
+	assert.ElementsMatch(t, []string{"f3:hi", "f4:hi"}, sentTo(s))
+}
@@ -1,47 +1,135 @@
 package padchat
 
 import (
+	"context"
 	"errors"
 	"regexp"
 	"strings"
-	"time"
 
 	"github.com/google/uuid"
 	"github.com/json-iterator/go"
 )
 
+// sendCommand 发送指令并等待返回, 超时时间由 SetCommandTimeout 设置
 func (bot *Bot) sendCommand(cmd string, data interface{}) CommandResp {
-	c := make(chan CommandResp)
+	resp, err := bot.sendCommandCtx(context.Background(), cmd, data)
+	if errors.Is(err, ErrTimeout) {
+		return CommandResp{Success: false, Msg: "timeout"}
+	}
+	if err != nil {
+		return CommandResp{Success: false, Msg: err.Error()}
+	}
+	return resp
+}
+
+// sendCommandCtx 发送指令并等待返回
+// ctx 未设置截止时间时使用 SetCommandTimeout 设置的超时时间, 超时返回 ErrTimeout,
+// ctx 被取消或超过截止时间时返回 context.Canceled 或 context.DeadlineExceeded
+func (bot *Bot) sendCommandCtx(ctx context.Context, cmd string, data interface{}) (CommandResp, error) {
 	id := uuid.New().String()
-	bot.retProcMap.Store(id, func(resp CommandResp) {
-		c <- resp
-	})
-	bot.ws.WriteJSON(WSReq{Type: "user", Cmd: cmd, CmdID: id, Data: data})
+	if bot.isClosed() {
+		return CommandResp{}, &Error{Cmd: cmd, CmdID: id, Err: ErrConnClosed}
+	}
+	parent := ctx
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, bot.reqTimeout)
+		defer cancel()
+	}
+	call := bot.pending.add(id, cmd)
+	err := bot.conn().WriteJSON(WSReq{Type: "user", Cmd: cmd, CmdID: id, Data: data})
+	if err != nil {
+		bot.pending.writeFailed(id)
+		return CommandResp{}, &Error{Cmd: cmd, CmdID: id, Err: err}
+	}
 	select {
-	case d := <-c:
-		return d
-	case <-time.After(bot.reqTimeout):
-		bot.retProcMap.Delete(id)
-		close(c)
-		return CommandResp{Success: false, Msg: "timeout"}
+	case d := <-call.ch:
+		d.cmdID = id
+		return d, nil
+	case <-bot.done:
+		bot.pending.remove(id)
+		return CommandResp{}, &Error{Cmd: cmd, CmdID: id, Err: ErrConnClosed}
+	case <-ctx.Done():
+		bot.pending.timedOut(id)
+		err := ctx.Err()
+		if parent.Err() == nil && err == context.DeadlineExceeded {
+			err = ErrTimeout
+		}
+		return CommandResp{}, &Error{Cmd: cmd, CmdID: id, Err: err}
 	}
 }
 
+// checkedCommand 发送指令, 服务端返回执行失败时同时返回 *Error, 用于返回 CommandResp 的指令
+func (bot *Bot) checkedCommand(ctx context.Context, cmd string, data interface{}) (CommandResp, error) {
+	resp, err := bot.sendCommandCtx(ctx, cmd, data)
+	if err == nil && !resp.Success {
+		err = &Error{Cmd: cmd, CmdID: resp.cmdID, Msg: resp.Msg}
+	}
+	return resp, err
+}
+
+// command 发送需要登录的指令并校验执行结果, v 不为 nil 时将返回数据解析到 v 中
+// 返回数据的 status 不为 0 时返回 ErrServerStatus
+func (bot *Bot) command(ctx context.Context, cmd string, data, v interface{}) error {
+	if !bot.isLoggedIn() {
+		return &Error{Cmd: cmd, Err: ErrNotLoggedIn}
+	}
+	resp, err := bot.sendCommandCtx(ctx, cmd, data)
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		return &Error{Cmd: cmd, CmdID: resp.cmdID, Msg: resp.Msg}
+	}
+	if v == nil {
+		return nil
+	}
+	if err := jsoniter.Unmarshal(resp.Data, v); err != nil {
+		return &Error{Cmd: cmd, CmdID: resp.cmdID, Err: err}
+	}
+	if s, ok := v.(statusResp); ok {
+		if status, msg := s.respStatus(); status != 0 {
+			return &Error{Cmd: cmd, CmdID: resp.cmdID, Msg: msg, Status: status, Err: ErrServerStatus}
+		}
+	}
+	if d, ok := v.(decodedResp); ok {
+		if err := d.decoded(); err != nil {
+			return &Error{Cmd: cmd, CmdID: resp.cmdID, Err: err}
+		}
+	}
+	return nil
+}
+
 // Init 执行初始化, 必须在登录前调用
 func (bot *Bot) Init() CommandResp {
 	return bot.sendCommand("init", nil)
 }
 
+// InitCtx 同 Init, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) InitCtx(ctx context.Context) (CommandResp, error) {
+	return bot.checkedCommand(ctx, "init", nil)
+}
+
 // Close 关闭微信实例（不退出登陆）
 func (bot *Bot) Close() CommandResp {
 	return bot.sendCommand("close", nil)
 }
 
+// CloseCtx 同 Close, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) CloseCtx(ctx context.Context) (CommandResp, error) {
+	return bot.checkedCommand(ctx, "close", nil)
+}
+
 // QRLogin 二维码登录
 func (bot *Bot) QRLogin() CommandResp {
 	return bot.sendCommand("login", LoginReq{LoginType: "qrcode"})
 }
 
+// QRLoginCtx 同 QRLogin, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) QRLoginCtx(ctx context.Context) (CommandResp, error) {
+	return bot.checkedCommand(ctx, "login", LoginReq{LoginType: "qrcode"})
+}
+
 // RequestLogin 二次登陆, 手机端会弹出确认框, 点击后登陆, 不容易封号
 func (bot *Bot) RequestLogin(wxData, token string) CommandResp {
 	return bot.sendCommand("login", LoginReq{
@@ -51,6 +139,15 @@ func (bot *Bot) RequestLogin(wxData, token string) CommandResp {
 	})
 }
 
+// RequestLoginCtx 同 RequestLogin, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) RequestLoginCtx(ctx context.Context, wxData, token string) (CommandResp, error) {
+	return bot.checkedCommand(ctx, "login", LoginReq{
+		LoginType: "request",
+		WXData:    wxData,
+		Token:     token,
+	})
+}
+
 // TokenLogin 断线重连, 用于短时间使用 `wxData` 和 `token` 再次登录
 // `token`有效期很短, 如果登陆失败, 建议使用二次登陆方式
 func (bot *Bot) TokenLogin(wxData, token string) CommandResp {
@@ -61,6 +158,15 @@ func (bot *Bot) TokenLogin(wxData, token string) CommandResp {
 	})
 }
 
+// TokenLoginCtx 同 TokenLogin, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) TokenLoginCtx(ctx context.Context, wxData, token string) (CommandResp, error) {
+	return bot.checkedCommand(ctx, "login", LoginReq{
+		LoginType: "token",
+		WXData:    wxData,
+		Token:     token,
+	})
+}
+
 // UserLogin 账号密码登录
 func (bot *Bot) UserLogin(wxData, username, password string) CommandResp {
 	return bot.sendCommand("login", LoginReq{
@@ -71,6 +177,16 @@ func (bot *Bot) UserLogin(wxData, username, password string) CommandResp {
 	})
 }
 
+// UserLoginCtx 同 UserLogin, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) UserLoginCtx(ctx context.Context, wxData, username, password string) (CommandResp, error) {
+	return bot.checkedCommand(ctx, "login", LoginReq{
+		LoginType: "user",
+		WXData:    wxData,
+		UserName:  username,
+		Password:  password,
+	})
+}
+
 // PhoneLogin 手机验证码登录
 func (bot *Bot) PhoneLogin(wxData, phone, code string) CommandResp {
 	return bot.sendCommand("login", LoginReq{
@@ -81,45 +197,57 @@ func (bot *Bot) PhoneLogin(wxData, phone, code string) CommandResp {
 	})
 }
 
+// PhoneLoginCtx 同 PhoneLogin, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) PhoneLoginCtx(ctx context.Context, wxData, phone, code string) (CommandResp, error) {
+	return bot.checkedCommand(ctx, "login", LoginReq{
+		LoginType: "phone",
+		WXData:    wxData,
+		Phone:     phone,
+		Code:      code,
+	})
+}
+
 // GetWXData 获取设备62数据
 func (bot *Bot) GetWXData() (string, error) {
+	return bot.GetWXDataCtx(context.Background())
+}
+
+// GetWXDataCtx 同 GetWXData, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) GetWXDataCtx(ctx context.Context) (string, error) {
 	data := &struct {
 		WXData string `json:"wx_data"`
 	}{}
-	resp := bot.sendCommand("getWxData", nil)
-	if !resp.Success {
-		return "", errors.New(resp.Msg)
-	}
-	err := jsoniter.Unmarshal(resp.Data, data)
-	if err != nil {
+	if err := bot.command(ctx, "getWxData", nil, data); err != nil {
 		return "", err
 	}
+	bot.session.setWXData(data.WXData)
 	return data.WXData, nil
 }
 
 // GetLoginToken 获取二次登陆数据
 func (bot *Bot) GetLoginToken() (*LoginTokenResp, error) {
+	return bot.GetLoginTokenCtx(context.Background())
+}
+
+// GetLoginTokenCtx 同 GetLoginToken, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) GetLoginTokenCtx(ctx context.Context) (*LoginTokenResp, error) {
 	data := &LoginTokenResp{}
-	resp := bot.sendCommand("getLoginToken", nil)
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	err := jsoniter.Unmarshal(resp.Data, data)
-	if err != nil {
+	if err := bot.command(ctx, "getLoginToken", nil, data); err != nil {
 		return nil, err
 	}
+	bot.session.setToken(data.Token)
 	return data, nil
 }
 
 // GetMyInfo 获取Bot微信号信息
 func (bot *Bot) GetMyInfo() (*MyInfoResp, error) {
+	return bot.GetMyInfoCtx(context.Background())
+}
+
+// GetMyInfoCtx 同 GetMyInfo, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) GetMyInfoCtx(ctx context.Context) (*MyInfoResp, error) {
 	data := &MyInfoResp{}
-	resp := bot.sendCommand("getMyInfo", nil)
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	err := jsoniter.Unmarshal(resp.Data, data)
-	if err != nil {
+	if err := bot.command(ctx, "getMyInfo", nil, data); err != nil {
 		return nil, err
 	}
 	return data, nil
@@ -131,26 +259,41 @@ func (bot *Bot) SyncMsg() CommandResp {
 	return bot.sendCommand("syncMsg", nil)
 }
 
+// SyncMsgCtx 同 SyncMsg, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) SyncMsgCtx(ctx context.Context) (CommandResp, error) {
+	return bot.checkedCommand(ctx, "syncMsg", nil)
+}
+
 // Logout 退出登录
 func (bot *Bot) Logout() CommandResp {
 	return bot.sendCommand("logout", nil)
 }
 
+// LogoutCtx 同 Logout, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) LogoutCtx(ctx context.Context) (CommandResp, error) {
+	return bot.checkedCommand(ctx, "logout", nil)
+}
+
 // SyncContact 同步通讯录
 func (bot *Bot) SyncContact() CommandResp {
 	return bot.sendCommand("syncContact", nil)
 }
 
+// SyncContactCtx 同 SyncContact, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) SyncContactCtx(ctx context.Context) (CommandResp, error) {
+	return bot.checkedCommand(ctx, "syncContact", nil)
+}
+
 // SendMsg 发送文字信息
 func (bot *Bot) SendMsg(req *SendMsgReq) (*SendMsgResp, error) {
+	return bot.SendMsgCtx(context.Background(), req)
+}
+
+// SendMsgCtx 同 SendMsg, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) SendMsgCtx(ctx context.Context, req *SendMsgReq) (*SendMsgResp, error) {
 	data := &SendMsgResp{}
 	MkAtContent(req)
-	resp := bot.sendCommand("sendMsg", req)
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	err := jsoniter.Unmarshal(resp.Data, data)
-	if err != nil {
+	if err := bot.command(ctx, "sendMsg", req, data); err != nil {
 		return nil, err
 	}
 	return data, nil
@@ -171,8 +314,13 @@ func MkAtContent(req *SendMsgReq) {
 
 // ShareCard 分享名片
 func (bot *Bot) ShareCard(toUserName, content, userId string) (*SendMsgResp, error) {
+	return bot.ShareCardCtx(context.Background(), toUserName, content, userId)
+}
+
+// ShareCardCtx 同 ShareCard, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) ShareCardCtx(ctx context.Context, toUserName, content, userId string) (*SendMsgResp, error) {
 	data := &SendMsgResp{}
-	resp := bot.sendCommand("shareCard", struct {
+	err := bot.command(ctx, "shareCard", struct {
 		ToUserName string `json:"toUserName"`
 		Content    string `json:"content"`
 		UserID     string `json:"userId"`
@@ -180,11 +328,7 @@ func (bot *Bot) ShareCard(toUserName, content, userId string) (*SendMsgResp, err
 		ToUserName: toUserName,
 		Content:    content,
 		UserID:     userId,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -193,13 +337,13 @@ func (bot *Bot) ShareCard(toUserName, content, userId string) (*SendMsgResp, err
 
 // SendImage 发送图片消息, file 为图片 base64 数据
 func (bot *Bot) SendImage(req SendMsgReq) (*SendMsgResp, error) {
+	return bot.SendImageCtx(context.Background(), req)
+}
+
+// SendImageCtx 同 SendImage, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) SendImageCtx(ctx context.Context, req SendMsgReq) (*SendMsgResp, error) {
 	data := &SendMsgResp{}
-	resp := bot.sendCommand("sendImage", req)
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	err := jsoniter.Unmarshal(resp.Data, data)
-	if err != nil {
+	if err := bot.command(ctx, "sendImage", req, data); err != nil {
 		return nil, err
 	}
 	return data, nil
@@ -207,54 +351,58 @@ func (bot *Bot) SendImage(req SendMsgReq) (*SendMsgResp, error) {
 
 // GetRoomMembers 获取群成员信息
 func (bot *Bot) GetRoomMembers(groupID string) (*ChatroomInfo, error) {
-	resp := bot.sendCommand("getRoomMembers", struct {
-		GroupID string `json:"groupId"`
-	}{GroupID: groupID})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
+	return bot.GetRoomMembersCtx(context.Background(), groupID)
+}
+
+// GetRoomMembersCtx 同 GetRoomMembers, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) GetRoomMembersCtx(ctx context.Context, groupID string) (*ChatroomInfo, error) {
 	chatroomInfo := &ChatroomInfo{}
-	err := jsoniter.Unmarshal(resp.Data, chatroomInfo)
-	if err != nil {
-		return nil, err
-	}
-	var ms []ChatMemberInfo
-	err = jsoniter.Unmarshal([]byte(chatroomInfo.Member), &ms)
+	err := bot.command(ctx, "getRoomMembers", struct {
+		GroupID string `json:"groupId"`
+	}{GroupID: groupID}, chatroomInfo)
 	if err != nil {
 		return nil, err
 	}
-	chatroomInfo.Members = ms
+	bot.contacts.SetRoomMembers(groupID, chatroomInfo.Members)
 	return chatroomInfo, nil
 }
 
+// decoded 解析 Member 中的群成员列表
+func (r *ChatroomInfo) decoded() error {
+	return jsoniter.Unmarshal([]byte(r.Member), &r.Members)
+}
+
 // GetContact 获取用户/群信息
 func (bot *Bot) GetContact(userID string) (*Contact, error) {
-	resp := bot.sendCommand("getContact", struct {
-		UserID string `json:"userId"`
-	}{UserID: userID})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
+	return bot.GetContactCtx(context.Background(), userID)
+}
+
+// GetContactCtx 同 GetContact, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) GetContactCtx(ctx context.Context, userID string) (*Contact, error) {
 	contact := &Contact{}
-	err := jsoniter.Unmarshal(resp.Data, contact)
+	err := bot.command(ctx, "getContact", struct {
+		UserID string `json:"userId"`
+	}{UserID: userID}, contact)
 	if err != nil {
 		return nil, err
 	}
+	bot.contacts.put(*contact)
 	return contact, nil
 }
 
 // GetMsgImage 获取消息原始图片
-// mType = 3
+// mType = MsgTypeImage
 func (bot *Bot) GetMsgImage(rawMsgData Msg) (*MsgImageResp, error) {
+	return bot.GetMsgImageCtx(context.Background(), rawMsgData)
+}
+
+// GetMsgImageCtx 同 GetMsgImage, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) GetMsgImageCtx(ctx context.Context, rawMsgData Msg) (*MsgImageResp, error) {
 	rawMsgData.Data = ""
-	resp := bot.sendCommand("getMsgImage", struct {
-		RawMsgData Msg `json:"rawMsgData"`
-	}{RawMsgData: rawMsgData})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
 	imgData := &MsgImageResp{}
-	err := jsoniter.Unmarshal(resp.Data, imgData)
+	err := bot.command(ctx, "getMsgImage", struct {
+		RawMsgData Msg `json:"rawMsgData"`
+	}{RawMsgData: rawMsgData}, imgData)
 	if err != nil {
 		return nil, err
 	}
@@ -262,17 +410,18 @@ func (bot *Bot) GetMsgImage(rawMsgData Msg) (*MsgImageResp, error) {
 }
 
 // GetMsgVideo 获取消息原始视频
-// mType = 43
+// mType = MsgTypeVideo
 func (bot *Bot) GetMsgVideo(rawMsgData Msg) (*MsgVideoResp, error) {
+	return bot.GetMsgVideoCtx(context.Background(), rawMsgData)
+}
+
+// GetMsgVideoCtx 同 GetMsgVideo, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) GetMsgVideoCtx(ctx context.Context, rawMsgData Msg) (*MsgVideoResp, error) {
 	rawMsgData.Data = ""
-	resp := bot.sendCommand("getMsgVideo", struct {
-		RawMsgData Msg `json:"rawMsgData"`
-	}{RawMsgData: rawMsgData})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
 	videoData := &MsgVideoResp{}
-	err := jsoniter.Unmarshal(resp.Data, videoData)
+	err := bot.command(ctx, "getMsgVideo", struct {
+		RawMsgData Msg `json:"rawMsgData"`
+	}{RawMsgData: rawMsgData}, videoData)
 	if err != nil {
 		return nil, err
 	}
@@ -280,17 +429,18 @@ func (bot *Bot) GetMsgVideo(rawMsgData Msg) (*MsgVideoResp, error) {
 }
 
 // GetMsgVoice 获取消息语音数据
-// mType = 34
+// mType = MsgTypeVoice
 func (bot *Bot) GetMsgVoice(rawMsgData Msg) (*MsgVoiceResp, error) {
+	return bot.GetMsgVoiceCtx(context.Background(), rawMsgData)
+}
+
+// GetMsgVoiceCtx 同 GetMsgVoice, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) GetMsgVoiceCtx(ctx context.Context, rawMsgData Msg) (*MsgVoiceResp, error) {
 	rawMsgData.Data = ""
-	resp := bot.sendCommand("getMsgVoice", struct {
-		RawMsgData Msg `json:"rawMsgData"`
-	}{RawMsgData: rawMsgData})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
 	voiceData := &MsgVoiceResp{}
-	err := jsoniter.Unmarshal(resp.Data, voiceData)
+	err := bot.command(ctx, "getMsgVoice", struct {
+		RawMsgData Msg `json:"rawMsgData"`
+	}{RawMsgData: rawMsgData}, voiceData)
 	if err != nil {
 		return nil, err
 	}
@@ -299,37 +449,39 @@ func (bot *Bot) GetMsgVoice(rawMsgData Msg) (*MsgVoiceResp, error) {
 
 // CreateRoom 创建群
 func (bot *Bot) CreateRoom(userList []string) (*CreateRoomResp, error) {
-	resp := bot.sendCommand("createRoom", struct {
-		UserList []string `json:"userList"`
-	}{UserList: userList})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
+	return bot.CreateRoomCtx(context.Background(), userList)
+}
+
+// CreateRoomCtx 同 CreateRoom, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) CreateRoomCtx(ctx context.Context, userList []string) (*CreateRoomResp, error) {
 	data := &CreateRoomResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	err := bot.command(ctx, "createRoom", struct {
+		UserList []string `json:"userList"`
+	}{UserList: userList}, data)
 	if err != nil {
 		return nil, err
 	}
 	if data.UserName == "" {
-		return nil, errors.New(data.Message)
+		return nil, &Error{Cmd: "createRoom", Msg: data.Message, Err: ErrServerStatus}
 	}
 	return data, nil
 }
 
 // AddRoomMember 添加群成员
 func (bot *Bot) AddRoomMember(groupID, userID string) (*MsgAndStatus, error) {
-	resp := bot.sendCommand("addRoomMember", struct {
+	return bot.AddRoomMemberCtx(context.Background(), groupID, userID)
+}
+
+// AddRoomMemberCtx 同 AddRoomMember, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) AddRoomMemberCtx(ctx context.Context, groupID, userID string) (*MsgAndStatus, error) {
+	data := &MsgAndStatus{}
+	err := bot.command(ctx, "addRoomMember", struct {
 		GroupID string `json:"groupId"`
 		UserID  string `json:"userId"`
 	}{
 		GroupID: groupID,
 		UserID:  userID,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &MsgAndStatus{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -338,18 +490,19 @@ func (bot *Bot) AddRoomMember(groupID, userID string) (*MsgAndStatus, error) {
 
 // InviteRoomMember 邀请群成员, 会给对方发送一条邀请消息, 无法判断对方是否真的接收到
 func (bot *Bot) InviteRoomMember(groupID, userID string) (*MsgAndStatus, error) {
-	resp := bot.sendCommand("inviteRoomMember", struct {
+	return bot.InviteRoomMemberCtx(context.Background(), groupID, userID)
+}
+
+// InviteRoomMemberCtx 同 InviteRoomMember, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) InviteRoomMemberCtx(ctx context.Context, groupID, userID string) (*MsgAndStatus, error) {
+	data := &MsgAndStatus{}
+	err := bot.command(ctx, "inviteRoomMember", struct {
 		GroupID string `json:"groupId"`
 		UserID  string `json:"userId"`
 	}{
 		GroupID: groupID,
 		UserID:  userID,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &MsgAndStatus{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -358,18 +511,19 @@ func (bot *Bot) InviteRoomMember(groupID, userID string) (*MsgAndStatus, error)
 
 // DeleteRoomMember 删除群成员
 func (bot *Bot) DeleteRoomMember(groupID, userID string) (*MsgAndStatus, error) {
-	resp := bot.sendCommand("deleteRoomMember", struct {
+	return bot.DeleteRoomMemberCtx(context.Background(), groupID, userID)
+}
+
+// DeleteRoomMemberCtx 同 DeleteRoomMember, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) DeleteRoomMemberCtx(ctx context.Context, groupID, userID string) (*MsgAndStatus, error) {
+	data := &MsgAndStatus{}
+	err := bot.command(ctx, "deleteRoomMember", struct {
 		GroupID string `json:"groupId"`
 		UserID  string `json:"userId"`
 	}{
 		GroupID: groupID,
 		UserID:  userID,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &MsgAndStatus{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -378,18 +532,19 @@ func (bot *Bot) DeleteRoomMember(groupID, userID string) (*MsgAndStatus, error)
 
 // SetRoomAnnouncement 设置群公告
 func (bot *Bot) SetRoomAnnouncement(groupID, content string) (*MsgAndStatus, error) {
-	resp := bot.sendCommand("setRoomAnnouncement", struct {
+	return bot.SetRoomAnnouncementCtx(context.Background(), groupID, content)
+}
+
+// SetRoomAnnouncementCtx 同 SetRoomAnnouncement, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) SetRoomAnnouncementCtx(ctx context.Context, groupID, content string) (*MsgAndStatus, error) {
+	data := &MsgAndStatus{}
+	err := bot.command(ctx, "setRoomAnnouncement", struct {
 		GroupID string `json:"groupId"`
 		Content string `json:"content"`
 	}{
 		GroupID: groupID,
 		Content: content,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &MsgAndStatus{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -398,18 +553,19 @@ func (bot *Bot) SetRoomAnnouncement(groupID, content string) (*MsgAndStatus, err
 
 // SetRoomName 设置群名称
 func (bot *Bot) SetRoomName(groupID, content string) (*MsgAndStatus, error) {
-	resp := bot.sendCommand("setRoomName", struct {
+	return bot.SetRoomNameCtx(context.Background(), groupID, content)
+}
+
+// SetRoomNameCtx 同 SetRoomName, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) SetRoomNameCtx(ctx context.Context, groupID, content string) (*MsgAndStatus, error) {
+	data := &MsgAndStatus{}
+	err := bot.command(ctx, "setRoomName", struct {
 		GroupID string `json:"groupId"`
 		Content string `json:"content"`
 	}{
 		GroupID: groupID,
 		Content: content,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &MsgAndStatus{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -418,16 +574,17 @@ func (bot *Bot) SetRoomName(groupID, content string) (*MsgAndStatus, error) {
 
 // QuitRoom 退出群
 func (bot *Bot) QuitRoom(groupID string) (*MsgAndStatus, error) {
-	resp := bot.sendCommand("quitRoom", struct {
+	return bot.QuitRoomCtx(context.Background(), groupID)
+}
+
+// QuitRoomCtx 同 QuitRoom, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) QuitRoomCtx(ctx context.Context, groupID string) (*MsgAndStatus, error) {
+	data := &MsgAndStatus{}
+	err := bot.command(ctx, "quitRoom", struct {
 		GroupID string `json:"groupId"`
 	}{
 		GroupID: groupID,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &MsgAndStatus{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -436,17 +593,18 @@ func (bot *Bot) QuitRoom(groupID string) (*MsgAndStatus, error) {
 
 // GetRoomQRCode 获取微信群二维码
 func (bot *Bot) GetRoomQRCode(groupID string) (*QRCodeResp, error) {
-	resp := bot.sendCommand("getRoomQrcode", struct {
+	return bot.GetRoomQRCodeCtx(context.Background(), groupID)
+}
+
+// GetRoomQRCodeCtx 同 GetRoomQRCode, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) GetRoomQRCodeCtx(ctx context.Context, groupID string) (*QRCodeResp, error) {
+	data := &QRCodeResp{}
+	err := bot.command(ctx, "getRoomQrcode", struct {
 		GroupID string `json:"groupId"`
 		Style   int    `json:"style"`
 	}{
 		GroupID: groupID,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &QRCodeResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -455,16 +613,17 @@ func (bot *Bot) GetRoomQRCode(groupID string) (*QRCodeResp, error) {
 
 // SearchContact 搜索用户
 func (bot *Bot) SearchContact(userID string) (*Contact, error) {
-	resp := bot.sendCommand("searchContact", struct {
+	return bot.SearchContactCtx(context.Background(), userID)
+}
+
+// SearchContactCtx 同 SearchContact, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) SearchContactCtx(ctx context.Context, userID string) (*Contact, error) {
+	data := &Contact{}
+	err := bot.command(ctx, "searchContact", struct {
 		UserID string `json:"userId"`
 	}{
 		UserID: userID,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &Contact{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -473,16 +632,17 @@ func (bot *Bot) SearchContact(userID string) (*Contact, error) {
 
 // DeleteContact 删除好友
 func (bot *Bot) DeleteContact(userID string) (*MsgAndStatus, error) {
-	resp := bot.sendCommand("deleteContact", struct {
+	return bot.DeleteContactCtx(context.Background(), userID)
+}
+
+// DeleteContactCtx 同 DeleteContact, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) DeleteContactCtx(ctx context.Context, userID string) (*MsgAndStatus, error) {
+	data := &MsgAndStatus{}
+	err := bot.command(ctx, "deleteContact", struct {
 		UserID string `json:"userId"`
 	}{
 		UserID: userID,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &MsgAndStatus{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -491,18 +651,19 @@ func (bot *Bot) DeleteContact(userID string) (*MsgAndStatus, error) {
 
 // GetUserQRCode 获取用户二维码, 仅限获取自己的二维码, 无法获取其他人的二维码
 func (bot *Bot) GetUserQRCode(userID string, style int) (*QRCodeResp, error) {
-	resp := bot.sendCommand("getRoomQrcode", struct {
+	return bot.GetUserQRCodeCtx(context.Background(), userID, style)
+}
+
+// GetUserQRCodeCtx 同 GetUserQRCode, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) GetUserQRCodeCtx(ctx context.Context, userID string, style int) (*QRCodeResp, error) {
+	data := &QRCodeResp{}
+	err := bot.command(ctx, "getRoomQrcode", struct {
 		UserID string `json:"userId"`
 		Style  int    `json:"style"`
 	}{
 		UserID: userID,
 		Style:  style,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &QRCodeResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -511,18 +672,19 @@ func (bot *Bot) GetUserQRCode(userID string, style int) (*QRCodeResp, error) {
 
 // AcceptUser 通过好友验证
 func (bot *Bot) AcceptUser(stranger, ticket string) (*MsgAndStatus, error) {
-	resp := bot.sendCommand("acceptUser", struct {
+	return bot.AcceptUserCtx(context.Background(), stranger, ticket)
+}
+
+// AcceptUserCtx 同 AcceptUser, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) AcceptUserCtx(ctx context.Context, stranger, ticket string) (*MsgAndStatus, error) {
+	data := &MsgAndStatus{}
+	err := bot.command(ctx, "acceptUser", struct {
 		Stranger string `json:"stranger"`
 		Ticket   string `json:"ticket"`
 	}{
 		Stranger: stranger,
 		Ticket:   ticket,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &MsgAndStatus{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -543,7 +705,13 @@ func (bot *Bot) AcceptUser(stranger, ticket string) (*MsgAndStatus, error) {
 // 25: 通过漂流瓶
 // 30: 通过二维码方式
 func (bot *Bot) AddContact(stranger, ticket, content string, Type int) (*MsgAndStatus, error) {
-	resp := bot.sendCommand("addContact", struct {
+	return bot.AddContactCtx(context.Background(), stranger, ticket, content, Type)
+}
+
+// AddContactCtx 同 AddContact, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) AddContactCtx(ctx context.Context, stranger, ticket, content string, Type int) (*MsgAndStatus, error) {
+	data := &MsgAndStatus{}
+	err := bot.command(ctx, "addContact", struct {
 		Stranger string `json:"stranger"`
 		Ticket   string `json:"ticket"`
 		Type     int    `json:"type"`
@@ -553,12 +721,7 @@ func (bot *Bot) AddContact(stranger, ticket, content string, Type int) (*MsgAndS
 		Ticket:   ticket,
 		Type:     Type,
 		Content:  content,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &MsgAndStatus{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -568,7 +731,13 @@ func (bot *Bot) AddContact(stranger, ticket, content string, Type int) (*MsgAndS
 // SayHello 打招呼,如果已经是好友, 会收到由系统自动发送, 来自对方的一条文本信息
 // "xx已通过你的朋友验证请求，现在可以开始聊天了"
 func (bot *Bot) SayHello(stranger, ticket, content string) (*MsgAndStatus, error) {
-	resp := bot.sendCommand("sayHello", struct {
+	return bot.SayHelloCtx(context.Background(), stranger, ticket, content)
+}
+
+// SayHelloCtx 同 SayHello, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) SayHelloCtx(ctx context.Context, stranger, ticket, content string) (*MsgAndStatus, error) {
+	data := &MsgAndStatus{}
+	err := bot.command(ctx, "sayHello", struct {
 		Stranger string `json:"stranger"`
 		Ticket   string `json:"ticket"`
 		Content  string `json:"content"`
@@ -576,12 +745,7 @@ func (bot *Bot) SayHello(stranger, ticket, content string) (*MsgAndStatus, error
 		Stranger: stranger,
 		Ticket:   ticket,
 		Content:  content,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &MsgAndStatus{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -590,18 +754,19 @@ func (bot *Bot) SayHello(stranger, ticket, content string) (*MsgAndStatus, error
 
 // SetRemark 设置备注
 func (bot *Bot) SetRemark(userID, remark string) (*MsgAndStatus, error) {
-	resp := bot.sendCommand("setRemark", struct {
+	return bot.SetRemarkCtx(context.Background(), userID, remark)
+}
+
+// SetRemarkCtx 同 SetRemark, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) SetRemarkCtx(ctx context.Context, userID, remark string) (*MsgAndStatus, error) {
+	data := &MsgAndStatus{}
+	err := bot.command(ctx, "setRemark", struct {
 		UserID string `json:"userId"`
 		Remark string `json:"remark"`
 	}{
 		UserID: userID,
 		Remark: remark,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &MsgAndStatus{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -610,16 +775,17 @@ func (bot *Bot) SetRemark(userID, remark string) (*MsgAndStatus, error) {
 
 // SetHeadImg 设置头像
 func (bot *Bot) SetHeadImg(file string) (*ImgResp, error) {
-	resp := bot.sendCommand("setHeadImg", struct {
+	return bot.SetHeadImgCtx(context.Background(), file)
+}
+
+// SetHeadImgCtx 同 SetHeadImg, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) SetHeadImgCtx(ctx context.Context, file string) (*ImgResp, error) {
+	data := &ImgResp{}
+	err := bot.command(ctx, "setHeadImg", struct {
 		File string `json:"file"`
 	}{
 		File: file,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &ImgResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -629,16 +795,17 @@ func (bot *Bot) SetHeadImg(file string) (*ImgResp, error) {
 // SNSUpload 上传图片到朋友圈
 // 此接口只能上传图片，并不会将图片发到朋友圈中
 func (bot *Bot) SNSUpload(file string) (*SNSUploadResp, error) {
-	resp := bot.sendCommand("snsUpload", struct {
+	return bot.SNSUploadCtx(context.Background(), file)
+}
+
+// SNSUploadCtx 同 SNSUpload, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) SNSUploadCtx(ctx context.Context, file string) (*SNSUploadResp, error) {
+	data := &SNSUploadResp{}
+	err := bot.command(ctx, "snsUpload", struct {
 		File string `json:"file"`
 	}{
 		File: file,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &SNSUploadResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -650,7 +817,14 @@ func (bot *Bot) SNSUpload(file string) (*SNSUploadResp, error) {
 // commentType - 操作类型，当删除评论时可用，需与评论type字段一致
 func (bot *Bot) SNSObjectOperation(momentID, commentID string,
 	Type, commentType int) (*MsgAndStatus, error) {
-	resp := bot.sendCommand("snsobjectOp", struct {
+	return bot.SNSObjectOperationCtx(context.Background(), momentID, commentID, Type, commentType)
+}
+
+// SNSObjectOperationCtx 同 SNSObjectOperation, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) SNSObjectOperationCtx(ctx context.Context, momentID, commentID string,
+	Type, commentType int) (*MsgAndStatus, error) {
+	data := &MsgAndStatus{}
+	err := bot.command(ctx, "snsobjectOp", struct {
 		MomentID    string `json:"momentId"`
 		Type        int    `json:"type"`
 		CommentID   string
@@ -660,12 +834,7 @@ func (bot *Bot) SNSObjectOperation(momentID, commentID string,
 		Type:        Type,
 		CommentID:   commentID,
 		CommentType: commentType,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &MsgAndStatus{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -675,16 +844,17 @@ func (bot *Bot) SNSObjectOperation(momentID, commentID string,
 // SNSSendMoment 发朋友圈
 // content - 文本内容或 TimeLineObject 结构体文本
 func (bot *Bot) SNSSendMoment(content string) (*MomentResp, error) {
-	resp := bot.sendCommand("snsSendMoment", struct {
+	return bot.SNSSendMomentCtx(context.Background(), content)
+}
+
+// SNSSendMomentCtx 同 SNSSendMoment, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) SNSSendMomentCtx(ctx context.Context, content string) (*MomentResp, error) {
+	data := &MomentResp{}
+	err := bot.command(ctx, "snsSendMoment", struct {
 		Content string `json:"content"`
 	}{
 		Content: content,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &MomentResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -694,18 +864,19 @@ func (bot *Bot) SNSSendMoment(content string) (*MomentResp, error) {
 // SNSUserPage 查看用户朋友圈
 // momentID 首次传入空即获取第一页, 以后传入上次拉取的最后一条信息ID
 func (bot *Bot) SNSUserPage(userID, momentID string) (*MomentListResp, error) {
-	resp := bot.sendCommand("snsUserPage", struct {
+	return bot.SNSUserPageCtx(context.Background(), userID, momentID)
+}
+
+// SNSUserPageCtx 同 SNSUserPage, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) SNSUserPageCtx(ctx context.Context, userID, momentID string) (*MomentListResp, error) {
+	data := &MomentListResp{}
+	err := bot.command(ctx, "snsUserPage", struct {
 		UserID   string `json:"userId"`
 		MomentID string `json:"momentId"`
 	}{
 		UserID:   userID,
 		MomentID: momentID,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &MomentListResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -715,16 +886,17 @@ func (bot *Bot) SNSUserPage(userID, momentID string) (*MomentListResp, error) {
 // SNSTimeLine 查看朋友圈动态
 // momentID 首次传入空即获取第一页, 以后传入上次拉取的最后一条信息ID
 func (bot *Bot) SNSTimeLine(momentID string) (*MomentListResp, error) {
-	resp := bot.sendCommand("snsTimeline", struct {
+	return bot.SNSTimeLineCtx(context.Background(), momentID)
+}
+
+// SNSTimeLineCtx 同 SNSTimeLine, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) SNSTimeLineCtx(ctx context.Context, momentID string) (*MomentListResp, error) {
+	data := &MomentListResp{}
+	err := bot.command(ctx, "snsTimeline", struct {
 		MomentID string `json:"momentId"`
 	}{
 		MomentID: momentID,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &MomentListResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -733,16 +905,17 @@ func (bot *Bot) SNSTimeLine(momentID string) (*MomentListResp, error) {
 
 // SNSGetObject 获取朋友圈信息详情
 func (bot *Bot) SNSGetObject(momentID string) (*MomentDetailResp, error) {
-	resp := bot.sendCommand("snsGetObject", struct {
+	return bot.SNSGetObjectCtx(context.Background(), momentID)
+}
+
+// SNSGetObjectCtx 同 SNSGetObject, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) SNSGetObjectCtx(ctx context.Context, momentID string) (*MomentDetailResp, error) {
+	data := &MomentDetailResp{}
+	err := bot.command(ctx, "snsGetObject", struct {
 		MomentID string `json:"momentId"`
 	}{
 		MomentID: momentID,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &MomentDetailResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -751,7 +924,13 @@ func (bot *Bot) SNSGetObject(momentID string) (*MomentDetailResp, error) {
 
 // SNSComment 评论朋友圈
 func (bot *Bot) SNSComment(userID, momentID, content string) (*MomentDetailResp, error) {
-	resp := bot.sendCommand("snsComment", struct {
+	return bot.SNSCommentCtx(context.Background(), userID, momentID, content)
+}
+
+// SNSCommentCtx 同 SNSComment, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) SNSCommentCtx(ctx context.Context, userID, momentID, content string) (*MomentDetailResp, error) {
+	data := &MomentDetailResp{}
+	err := bot.command(ctx, "snsComment", struct {
 		UserID   string `json:"userId"`
 		MomentID string `json:"momentId"`
 		Content  string `json:"content"`
@@ -759,12 +938,7 @@ func (bot *Bot) SNSComment(userID, momentID, content string) (*MomentDetailResp,
 		UserID:   userID,
 		MomentID: momentID,
 		Content:  content,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &MomentDetailResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -773,18 +947,19 @@ func (bot *Bot) SNSComment(userID, momentID, content string) (*MomentDetailResp,
 
 // SNSLike 朋友圈点赞
 func (bot *Bot) SNSLike(userID, momentID string) (*MomentDetailResp, error) {
-	resp := bot.sendCommand("snsLike", struct {
+	return bot.SNSLikeCtx(context.Background(), userID, momentID)
+}
+
+// SNSLikeCtx 同 SNSLike, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) SNSLikeCtx(ctx context.Context, userID, momentID string) (*MomentDetailResp, error) {
+	data := &MomentDetailResp{}
+	err := bot.command(ctx, "snsLike", struct {
 		UserID   string `json:"userId"`
 		MomentID string `json:"momentId"`
 	}{
 		UserID:   userID,
 		MomentID: momentID,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &MomentDetailResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -793,16 +968,17 @@ func (bot *Bot) SNSLike(userID, momentID string) (*MomentDetailResp, error) {
 
 // SyncFav 同步收藏消息
 func (bot *Bot) SyncFav(favKey string) (*FavListResp, error) {
-	resp := bot.sendCommand("syncFav", struct {
+	return bot.SyncFavCtx(context.Background(), favKey)
+}
+
+// SyncFavCtx 同 SyncFav, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) SyncFavCtx(ctx context.Context, favKey string) (*FavListResp, error) {
+	data := &FavListResp{}
+	err := bot.command(ctx, "syncFav", struct {
 		FavKey string `json:"favKey"`
 	}{
 		FavKey: favKey,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &FavListResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -811,16 +987,17 @@ func (bot *Bot) SyncFav(favKey string) (*FavListResp, error) {
 
 // AddFav 添加收藏
 func (bot *Bot) AddFav(content string) (*AddFavResp, error) {
-	resp := bot.sendCommand("addFav", struct {
+	return bot.AddFavCtx(context.Background(), content)
+}
+
+// AddFavCtx 同 AddFav, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) AddFavCtx(ctx context.Context, content string) (*AddFavResp, error) {
+	data := &AddFavResp{}
+	err := bot.command(ctx, "addFav", struct {
 		Content string `json:"content"`
 	}{
 		Content: content,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &AddFavResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -829,16 +1006,17 @@ func (bot *Bot) AddFav(content string) (*AddFavResp, error) {
 
 // GetFav 获取收藏消息详情
 func (bot *Bot) GetFav(favID int) (*FavResp, error) {
-	resp := bot.sendCommand("getFav", struct {
+	return bot.GetFavCtx(context.Background(), favID)
+}
+
+// GetFavCtx 同 GetFav, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) GetFavCtx(ctx context.Context, favID int) (*FavResp, error) {
+	data := &FavResp{}
+	err := bot.command(ctx, "getFav", struct {
 		FavID int `json:"favId"`
 	}{
 		FavID: favID,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &FavResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -847,16 +1025,17 @@ func (bot *Bot) GetFav(favID int) (*FavResp, error) {
 
 // DeleteFav 删除收藏
 func (bot *Bot) DeleteFav(favID int) (*FavResp, error) {
-	resp := bot.sendCommand("deleteFav", struct {
+	return bot.DeleteFavCtx(context.Background(), favID)
+}
+
+// DeleteFavCtx 同 DeleteFav, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) DeleteFavCtx(ctx context.Context, favID int) (*FavResp, error) {
+	data := &FavResp{}
+	err := bot.command(ctx, "deleteFav", struct {
 		FavID int `json:"favId"`
 	}{
 		FavID: favID,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &FavResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -865,13 +1044,13 @@ func (bot *Bot) DeleteFav(favID int) (*FavResp, error) {
 
 // GetLabelList 获取所有标签
 func (bot *Bot) GetLabelList() (*LabelListResp, error) {
-	resp := bot.sendCommand("getLabelList", nil)
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
+	return bot.GetLabelListCtx(context.Background())
+}
+
+// GetLabelListCtx 同 GetLabelList, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) GetLabelListCtx(ctx context.Context) (*LabelListResp, error) {
 	data := &LabelListResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
-	if err != nil {
+	if err := bot.command(ctx, "getLabelList", nil, data); err != nil {
 		return nil, err
 	}
 	return data, nil
@@ -879,14 +1058,15 @@ func (bot *Bot) GetLabelList() (*LabelListResp, error) {
 
 // AddLabel 添加标签
 func (bot *Bot) AddLabel(label string) (*MsgAndStatus, error) {
-	resp := bot.sendCommand("addLabel", struct {
-		Label string `json:"label"`
-	}{Label: label})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
+	return bot.AddLabelCtx(context.Background(), label)
+}
+
+// AddLabelCtx 同 AddLabel, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) AddLabelCtx(ctx context.Context, label string) (*MsgAndStatus, error) {
 	data := &MsgAndStatus{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	err := bot.command(ctx, "addLabel", struct {
+		Label string `json:"label"`
+	}{Label: label}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -895,14 +1075,15 @@ func (bot *Bot) AddLabel(label string) (*MsgAndStatus, error) {
 
 // DeleteLabel 删除标签
 func (bot *Bot) DeleteLabel(labelID int) (*MsgAndStatus, error) {
-	resp := bot.sendCommand("deleteLabel", struct {
-		LabelID int `json:"labelId"`
-	}{LabelID: labelID})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
+	return bot.DeleteLabelCtx(context.Background(), labelID)
+}
+
+// DeleteLabelCtx 同 DeleteLabel, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) DeleteLabelCtx(ctx context.Context, labelID int) (*MsgAndStatus, error) {
 	data := &MsgAndStatus{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	err := bot.command(ctx, "deleteLabel", struct {
+		LabelID int `json:"labelId"`
+	}{LabelID: labelID}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -911,15 +1092,16 @@ func (bot *Bot) DeleteLabel(labelID int) (*MsgAndStatus, error) {
 
 // SetLabel 设置用户标签
 func (bot *Bot) SetLabel(userID string, labelID int) (*MsgAndStatus, error) {
-	resp := bot.sendCommand("setLabel", struct {
+	return bot.SetLabelCtx(context.Background(), userID, labelID)
+}
+
+// SetLabelCtx 同 SetLabel, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) SetLabelCtx(ctx context.Context, userID string, labelID int) (*MsgAndStatus, error) {
+	data := &MsgAndStatus{}
+	err := bot.command(ctx, "setLabel", struct {
 		LabelID int    `json:"labelId"`
 		UserID  string `json:"userId"`
-	}{LabelID: labelID})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &MsgAndStatus{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}{LabelID: labelID}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -927,18 +1109,19 @@ func (bot *Bot) SetLabel(userID string, labelID int) (*MsgAndStatus, error) {
 }
 
 // ReceiveRedPacket 接收红包
-// mType = 49
-// 使用 bytes.Contains(msg.Content, []byte("<![CDATA[微信红包]]>")) 与转账区分
+// mType = MsgTypeApp
+// 使用 ParseMsg 解析为 RedPacketMsg 与转账区分
 func (bot *Bot) ReceiveRedPacket(rawMsgData Msg) (*ExternalMsgResp, error) {
+	return bot.ReceiveRedPacketCtx(context.Background(), rawMsgData)
+}
+
+// ReceiveRedPacketCtx 同 ReceiveRedPacket, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) ReceiveRedPacketCtx(ctx context.Context, rawMsgData Msg) (*ExternalMsgResp, error) {
 	rawMsgData.Data = ""
-	resp := bot.sendCommand("receiveRedPacket", struct {
-		RawMsgData Msg `json:"rawMsgData"`
-	}{RawMsgData: rawMsgData})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
 	data := &ExternalMsgResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	err := bot.command(ctx, "receiveRedPacket", struct {
+		RawMsgData Msg `json:"rawMsgData"`
+	}{RawMsgData: rawMsgData}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -947,19 +1130,20 @@ func (bot *Bot) ReceiveRedPacket(rawMsgData Msg) (*ExternalMsgResp, error) {
 
 // QueryRedPacket 查看红包信息, 如果是别人发的红包, 未领取且未领取完毕时, 无法取到红包信息
 func (bot *Bot) QueryRedPacket(rawMsgData Msg, index int) (*ExternalMsgResp, error) {
+	return bot.QueryRedPacketCtx(context.Background(), rawMsgData, index)
+}
+
+// QueryRedPacketCtx 同 QueryRedPacket, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) QueryRedPacketCtx(ctx context.Context, rawMsgData Msg, index int) (*ExternalMsgResp, error) {
 	rawMsgData.Data = ""
-	resp := bot.sendCommand("queryRedPacket", struct {
+	data := &ExternalMsgResp{}
+	err := bot.command(ctx, "queryRedPacket", struct {
 		RawMsgData Msg `json:"rawMsgData"`
 		Index      int `json:"index"`
 	}{
 		Index:      index,
 		RawMsgData: rawMsgData,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &ExternalMsgResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -968,19 +1152,20 @@ func (bot *Bot) QueryRedPacket(rawMsgData Msg, index int) (*ExternalMsgResp, err
 
 // OpenRedPacket 领取红包
 func (bot *Bot) OpenRedPacket(rawMsgData Msg, key string) (*ExternalMsgResp, error) {
+	return bot.OpenRedPacketCtx(context.Background(), rawMsgData, key)
+}
+
+// OpenRedPacketCtx 同 OpenRedPacket, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) OpenRedPacketCtx(ctx context.Context, rawMsgData Msg, key string) (*ExternalMsgResp, error) {
 	rawMsgData.Data = ""
-	resp := bot.sendCommand("openRedPacket", struct {
+	data := &ExternalMsgResp{}
+	err := bot.command(ctx, "openRedPacket", struct {
 		RawMsgData Msg    `json:"rawMsgData"`
 		Key        string `json:"key"`
 	}{
 		Key:        key,
 		RawMsgData: rawMsgData,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &ExternalMsgResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -989,17 +1174,18 @@ func (bot *Bot) OpenRedPacket(rawMsgData Msg, key string) (*ExternalMsgResp, err
 
 // QueryTransfer 查看转账消息
 func (bot *Bot) QueryTransfer(rawMsgData Msg) (*ExternalMsgResp, error) {
+	return bot.QueryTransferCtx(context.Background(), rawMsgData)
+}
+
+// QueryTransferCtx 同 QueryTransfer, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) QueryTransferCtx(ctx context.Context, rawMsgData Msg) (*ExternalMsgResp, error) {
 	rawMsgData.Data = ""
-	resp := bot.sendCommand("queryTransfer", struct {
+	data := &ExternalMsgResp{}
+	err := bot.command(ctx, "queryTransfer", struct {
 		RawMsgData Msg `json:"rawMsgData"`
 	}{
 		RawMsgData: rawMsgData,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &ExternalMsgResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -1007,20 +1193,21 @@ func (bot *Bot) QueryTransfer(rawMsgData Msg) (*ExternalMsgResp, error) {
 }
 
 // AcceptTransfer 接受转账
-// mType = 49
-// 使用 bytes.Contains(msg.Content, []byte("<![CDATA[微信转账]]>")) 与红包区分
+// mType = MsgTypeApp
+// 使用 ParseMsg 解析为 TransferMsg 与红包区分
 func (bot *Bot) AcceptTransfer(rawMsgData Msg) (*ExternalMsgResp, error) {
+	return bot.AcceptTransferCtx(context.Background(), rawMsgData)
+}
+
+// AcceptTransferCtx 同 AcceptTransfer, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) AcceptTransferCtx(ctx context.Context, rawMsgData Msg) (*ExternalMsgResp, error) {
 	rawMsgData.Data = ""
-	resp := bot.sendCommand("acceptTransfer", struct {
+	data := &ExternalMsgResp{}
+	err := bot.command(ctx, "acceptTransfer", struct {
 		RawMsgData Msg `json:"rawMsgData"`
 	}{
 		RawMsgData: rawMsgData,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &ExternalMsgResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -1029,16 +1216,17 @@ func (bot *Bot) AcceptTransfer(rawMsgData Msg) (*ExternalMsgResp, error) {
 
 // SearchMp 搜索公众号
 func (bot *Bot) SearchMp(content string) (*SearchMPResp, error) {
-	resp := bot.sendCommand("searchMp", struct {
+	return bot.SearchMpCtx(context.Background(), content)
+}
+
+// SearchMpCtx 同 SearchMp, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) SearchMpCtx(ctx context.Context, content string) (*SearchMPResp, error) {
+	data := &SearchMPResp{}
+	err := bot.command(ctx, "searchMp", struct {
 		Content string `json:"content"`
 	}{
 		Content: content,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &SearchMPResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -1047,16 +1235,17 @@ func (bot *Bot) SearchMp(content string) (*SearchMPResp, error) {
 
 // GetSubscriptionInfo 获取公众号信息
 func (bot *Bot) GetSubscriptionInfo(ghName string) (*SearchMPResp, error) {
-	resp := bot.sendCommand("getSubscriptionInfo", struct {
+	return bot.GetSubscriptionInfoCtx(context.Background(), ghName)
+}
+
+// GetSubscriptionInfoCtx 同 GetSubscriptionInfo, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) GetSubscriptionInfoCtx(ctx context.Context, ghName string) (*SearchMPResp, error) {
+	data := &SearchMPResp{}
+	err := bot.command(ctx, "getSubscriptionInfo", struct {
 		GhName string `json:"ghName"`
 	}{
 		GhName: ghName,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &SearchMPResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -1065,7 +1254,13 @@ func (bot *Bot) GetSubscriptionInfo(ghName string) (*SearchMPResp, error) {
 
 // OperateSubscription 操作公众号菜单
 func (bot *Bot) OperateSubscription(ghName string, menuId int, menuKey string) (*MsgAndStatus, error) {
-	resp := bot.sendCommand("operateSubscription", struct {
+	return bot.OperateSubscriptionCtx(context.Background(), ghName, menuId, menuKey)
+}
+
+// OperateSubscriptionCtx 同 OperateSubscription, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) OperateSubscriptionCtx(ctx context.Context, ghName string, menuId int, menuKey string) (*MsgAndStatus, error) {
+	data := &MsgAndStatus{}
+	err := bot.command(ctx, "operateSubscription", struct {
 		GhName  string `json:"ghName"`
 		MenuID  int    `json:"menuId"`
 		MenuKey string `json:"menuKey"`
@@ -1073,12 +1268,7 @@ func (bot *Bot) OperateSubscription(ghName string, menuId int, menuKey string) (
 		GhName:  ghName,
 		MenuID:  menuId,
 		MenuKey: menuKey,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &MsgAndStatus{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -1087,18 +1277,19 @@ func (bot *Bot) OperateSubscription(ghName string, menuId int, menuKey string) (
 
 // GetRequestToken 获取网页访问授权
 func (bot *Bot) GetRequestToken(ghName, url string) (*RequestTokenResp, error) {
-	resp := bot.sendCommand("getRequestToken", struct {
+	return bot.GetRequestTokenCtx(context.Background(), ghName, url)
+}
+
+// GetRequestTokenCtx 同 GetRequestToken, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) GetRequestTokenCtx(ctx context.Context, ghName, url string) (*RequestTokenResp, error) {
+	data := &RequestTokenResp{}
+	err := bot.command(ctx, "getRequestToken", struct {
 		GhName string `json:"ghName"`
 		URL    string `json:"url"`
 	}{
 		GhName: ghName,
 		URL:    url,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &RequestTokenResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -1107,7 +1298,13 @@ func (bot *Bot) GetRequestToken(ghName, url string) (*RequestTokenResp, error) {
 
 // RequestUrl 访问网页
 func (bot *Bot) RequestUrl(url, xKey, xUin string) (*RequestUrlResp, error) {
-	resp := bot.sendCommand("requestUrl", struct {
+	return bot.RequestUrlCtx(context.Background(), url, xKey, xUin)
+}
+
+// RequestUrlCtx 同 RequestUrl, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) RequestUrlCtx(ctx context.Context, url, xKey, xUin string) (*RequestUrlResp, error) {
+	data := &RequestUrlResp{}
+	err := bot.command(ctx, "requestUrl", struct {
 		URL  string `json:"url"`
 		XKey string `json:"xKey"`
 		XUin string `json:"xUin"`
@@ -1115,12 +1312,7 @@ func (bot *Bot) RequestUrl(url, xKey, xUin string) (*RequestUrlResp, error) {
 		URL:  url,
 		XKey: xKey,
 		XUin: xUin,
-	})
-	if !resp.Success {
-		return nil, errors.New(resp.Msg)
-	}
-	data := &RequestUrlResp{}
-	err := jsoniter.Unmarshal(resp.Data, data)
+	}, data)
 	if err != nil {
 		return nil, err
 	}
@@ -1,11 +1,17 @@
 package padchat_test
 
 import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/tuotoo/padchat"
+	"github.com/tuotoo/padchat/padchattest"
 )
 
 func TestMkAtContent(t *testing.T) {
@@ -21,3 +27,105 @@ func TestMkAtContent(t *testing.T) {
 	padchat.MkAtContent(req)
 	assert.Equal(t, "@\n@@\ntest", req.Content)
 }
+
+func TestCommandWriteError(t *testing.T) {
+	bot, s := newTestBot(t)
+	disconnected := make(chan struct{})
+	bot.OnDisconnect(func(error) { close(disconnected) })
+	s.DropConns()
+	<-disconnected
+	start := time.Now()
+	_, err := bot.SyncMsgCtx(context.Background())
+	assert.True(t, errors.Is(err, padchat.ErrConnClosed))
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, uint64(1), bot.CommandStats().WriteErrors)
+}
+
+func TestCommandLateReply(t *testing.T) {
+	bot, s := newTestBot(t, padchat.WithCommandTimeout(20*time.Millisecond))
+	s.Handle("syncMsg", func(padchattest.Request) padchattest.Reply {
+		return padchattest.Reply{Success: true, Delay: 50 * time.Millisecond}
+	})
+	// init 指令的返回不计入迟到的返回
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, uint64(0), bot.CommandStats().LateReplies)
+	assert.Equal(t, "timeout", bot.SyncMsg().Msg)
+	for i := 0; i < 100 && bot.CommandStats().LateReplies == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	stats := bot.CommandStats()
+	assert.Equal(t, uint64(1), stats.LateReplies)
+	assert.Equal(t, 0, stats.Pending)
+	assert.Equal(t, uint64(1), stats.Timeouts)
+}
+
+func TestCommandConcurrent(t *testing.T) {
+	bot, s := newTestBot(t, padchat.WithCommandTimeout(200*time.Millisecond))
+	login(t, bot)
+	s.Handle("getContact", func(req padchattest.Request) padchattest.Reply {
+		var data struct {
+			UserID string `json:"userId"`
+		}
+		req.Bind(&data)
+		if data.UserID == "timeout" {
+			return padchattest.Reply{NoReply: true}
+		}
+		return padchattest.Reply{
+			Success: true,
+			Data:    padchat.Contact{UserName: data.UserID},
+			Delay:   time.Duration(len(data.UserID)) * time.Millisecond,
+		}
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := strings.Repeat("a", i%10+1)
+			if i%10 == 0 {
+				id = "timeout"
+			}
+			contact, err := bot.GetContact(id)
+			if id == "timeout" {
+				assert.True(t, errors.Is(err, padchat.ErrTimeout))
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, id, contact.UserName)
+			}
+		}(i)
+	}
+	wg.Wait()
+	stats := bot.CommandStats()
+	assert.Equal(t, 0, stats.Pending)
+	assert.Equal(t, uint64(10), stats.Timeouts)
+}
+
+func TestCommandError(t *testing.T) {
+	bot, s := newTestBot(t)
+	login(t, bot)
+	s.Handle("syncMsg", func(padchattest.Request) padchattest.Reply {
+		return padchattest.Fail("busy")
+	})
+	resp, err := bot.SyncMsgCtx(context.Background())
+	assert.False(t, resp.Success)
+	var cerr *padchat.Error
+	if assert.True(t, errors.As(err, &cerr)) {
+		assert.Equal(t, "syncMsg", cerr.Cmd)
+		assert.Equal(t, "busy", cerr.Msg)
+		assert.NotEmpty(t, cerr.CmdID)
+	}
+	// 不带 ctx 的版本仍只通过 CommandResp 返回
+	assert.Equal(t, "busy", bot.SyncMsg().Msg)
+
+	// 群成员列表解析失败时同样返回 *Error
+	s.Reply("getRoomMembers", padchat.ChatroomInfo{Member: "not json"})
+	_, err = bot.GetRoomMembersCtx(context.Background(), "123@chatroom")
+	cerr = nil
+	if assert.True(t, errors.As(err, &cerr)) {
+		assert.Equal(t, "getRoomMembers", cerr.Cmd)
+		assert.NotEmpty(t, cerr.CmdID)
+		assert.Error(t, cerr.Err)
+	}
+}
@@ -0,0 +1,276 @@
+package padchat
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// officialPrefix 公众号 ID 的前缀
+const officialPrefix = "gh_"
+
+// ContactKind 联系人类型
+type ContactKind int
+
+const (
+	// ContactFriend 好友或其他个人用户
+	ContactFriend ContactKind = iota
+	// ContactRoom 群
+	ContactRoom
+	// ContactOfficial 公众号
+	ContactOfficial
+)
+
+func (k ContactKind) String() string {
+	switch k {
+	case ContactFriend:
+		return "friend"
+	case ContactRoom:
+		return "room"
+	case ContactOfficial:
+		return "official"
+	}
+	return "unknown"
+}
+
+// Kind 根据 UserName 判断联系人类型
+func (c Contact) Kind() ContactKind {
+	switch {
+	case c.IsRoom():
+		return ContactRoom
+	case strings.HasPrefix(c.UserName, officialPrefix):
+		return ContactOfficial
+	}
+	return ContactFriend
+}
+
+// LabelIDs 返回联系人的标签 ID
+func (c Contact) LabelIDs() []int {
+	var ids []int
+	for _, s := range strings.Split(c.Label, ",") {
+		if id, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// ContactChangeType 联系人变化类型
+type ContactChangeType int
+
+const (
+	// ContactAdded 新增联系人
+	ContactAdded ContactChangeType = iota
+	// ContactUpdated 联系人信息变化
+	ContactUpdated
+	// ContactRemoved 删除联系人
+	ContactRemoved
+)
+
+// ContactChange 联系人变化通知, 新增时 Old 为零值, 删除时 New 为零值
+type ContactChange struct {
+	Type ContactChangeType
+	Old  Contact
+	New  Contact
+}
+
+// ContactStore 联系人缓存, 保存好友, 群和公众号的最新信息
+// Bot 会使用联系人推送, GetContact 和 GetRoomMembers 的结果自动更新, 通过 Bot.Contacts 获取
+type ContactStore struct {
+	mu       sync.RWMutex
+	contacts map[string]Contact
+	members  map[string][]ChatMemberInfo
+	onChange handlerList[func(ContactChange)]
+	// onPanic 处理 OnChange 回调中的 panic, Bot 的联系人缓存交给 OnHandlerPanic
+	onPanic func(v interface{}, stack []byte)
+}
+
+// NewContactStore 新建空的联系人缓存
+func NewContactStore() *ContactStore {
+	return &ContactStore{
+		contacts: make(map[string]Contact),
+		members:  make(map[string][]ChatMemberInfo),
+	}
+}
+
+// Put 添加或更新联系人, 信息有变化时通知 OnChange 回调
+func (s *ContactStore) Put(c Contact) {
+	s.put(c)
+}
+
+// put 添加或更新联系人, 返回更新前的信息
+func (s *ContactStore) put(c Contact) (old Contact, existed bool) {
+	if c.UserName == "" {
+		return Contact{}, false
+	}
+	s.mu.Lock()
+	old, existed = s.contacts[c.UserName]
+	s.contacts[c.UserName] = c
+	s.mu.Unlock()
+	switch {
+	case !existed:
+		s.notify(ContactChange{Type: ContactAdded, New: c})
+	case old != c:
+		s.notify(ContactChange{Type: ContactUpdated, Old: old, New: c})
+	}
+	return old, existed
+}
+
+// Remove 删除联系人
+func (s *ContactStore) Remove(userName string) {
+	s.mu.Lock()
+	old, ok := s.contacts[userName]
+	delete(s.contacts, userName)
+	delete(s.members, userName)
+	s.mu.Unlock()
+	if ok {
+		s.notify(ContactChange{Type: ContactRemoved, Old: old})
+	}
+}
+
+// SetRoomMembers 保存群成员的详细信息, 不会触发 OnChange 回调
+func (s *ContactStore) SetRoomMembers(roomID string, members []ChatMemberInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.members[roomID] = members
+}
+
+// OnChange 联系人变化回调, 在更新联系人的协程中同步执行,
+// 回调中的 panic 会被捕获, Bot 的联系人缓存会交给 OnHandlerPanic 回调
+func (s *ContactStore) OnChange(f func(c ContactChange)) (unsubscribe func()) {
+	return s.onChange.add(f)
+}
+
+func (s *ContactStore) notify(c ContactChange) {
+	s.onChange.each(func(f func(ContactChange)) { f(c) }, func(v interface{}, stack []byte) {
+		if s.onPanic != nil {
+			s.onPanic(v, stack)
+		}
+	})
+}
+
+// Get 按 ID 获取联系人
+func (s *ContactStore) Get(userName string) (Contact, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.contacts[userName]
+	return c, ok
+}
+
+// Len 返回联系人数量
+func (s *ContactStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.contacts)
+}
+
+// Filter 返回满足条件的联系人, 按 ID 排序
+func (s *ContactStore) Filter(match func(c Contact) bool) []Contact {
+	s.mu.RLock()
+	var list []Contact
+	for _, c := range s.contacts {
+		if match(c) {
+			list = append(list, c)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].UserName < list[j].UserName
+	})
+	return list
+}
+
+// All 返回所有联系人
+func (s *ContactStore) All() []Contact {
+	return s.Filter(func(Contact) bool { return true })
+}
+
+// Friends 返回所有好友
+func (s *ContactStore) Friends() []Contact {
+	return s.ofKind(ContactFriend)
+}
+
+// Rooms 返回所有群
+func (s *ContactStore) Rooms() []Contact {
+	return s.ofKind(ContactRoom)
+}
+
+// Officials 返回所有公众号
+func (s *ContactStore) Officials() []Contact {
+	return s.ofKind(ContactOfficial)
+}
+
+func (s *ContactStore) ofKind(kind ContactKind) []Contact {
+	return s.Filter(func(c Contact) bool { return c.Kind() == kind })
+}
+
+// FindByNickName 按昵称查找联系人
+func (s *ContactStore) FindByNickName(name string) []Contact {
+	return s.Filter(func(c Contact) bool { return c.NickName == name })
+}
+
+// FindByRemark 按备注查找联系人
+func (s *ContactStore) FindByRemark(remark string) []Contact {
+	return s.Filter(func(c Contact) bool { return c.Remark == remark })
+}
+
+// FindByPinyin 按拼音前缀查找联系人, 不区分大小写,
+// 同时匹配昵称和备注的拼音首字母及全拼
+func (s *ContactStore) FindByPinyin(py string) []Contact {
+	py = strings.ToLower(py)
+	return s.Filter(func(c Contact) bool {
+		for _, v := range []string{c.PyInitial, c.QuanPin, c.RemarkPyInitial, c.RemarkQuanPin} {
+			if v != "" && strings.HasPrefix(strings.ToLower(v), py) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// FindByLabel 查找带有指定标签的联系人
+func (s *ContactStore) FindByLabel(labelID int) []Contact {
+	return s.Filter(func(c Contact) bool {
+		for _, id := range c.LabelIDs() {
+			if id == labelID {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// RoomMembers 返回群成员, 调用过 GetRoomMembers 时包含成员的详细信息,
+// 否则只有根据群推送得到的成员 ID
+func (s *ContactStore) RoomMembers(roomID string) []ChatMemberInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if members, ok := s.members[roomID]; ok {
+		return append([]ChatMemberInfo(nil), members...)
+	}
+	var members []ChatMemberInfo
+	for _, id := range s.contacts[roomID].Members() {
+		members = append(members, ChatMemberInfo{UserName: id})
+	}
+	return members
+}
+
+// RoomsOf 返回 userName 所在的群
+func (s *ContactStore) RoomsOf(userName string) []Contact {
+	var rooms []Contact
+	for _, room := range s.Rooms() {
+		for _, m := range s.RoomMembers(room.UserName) {
+			if m.UserName == userName {
+				rooms = append(rooms, room)
+				break
+			}
+		}
+	}
+	return rooms
+}
+
+// Contacts 返回 Bot 的联系人缓存
+func (bot *Bot) Contacts() *ContactStore {
+	return bot.contacts
+}
@@ -0,0 +1,139 @@
+package padchat_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuotoo/padchat"
+	"github.com/tuotoo/padchat/padchattest"
+)
+
+func userNames(list []padchat.Contact) []string {
+	var names []string
+	for _, c := range list {
+		names = append(names, c.UserName)
+	}
+	return names
+}
+
+func TestContactStore(t *testing.T) {
+	s := padchat.NewContactStore()
+	var changes []padchat.ContactChange
+	s.OnChange(func(c padchat.ContactChange) { changes = append(changes, c) })
+
+	s.Put(padchat.Contact{UserName: "wxid_a", NickName: "张三", QuanPin: "zhangsan", PyInitial: "ZS", Label: "1,2"})
+	s.Put(padchat.Contact{UserName: "wxid_b", NickName: "李四", Remark: "老李", RemarkQuanPin: "laoli", Label: "2"})
+	s.Put(padchat.Contact{UserName: "123@chatroom", NickName: "群", Member: `["wxid_a","wxid_c"]`})
+	s.Put(padchat.Contact{UserName: "gh_abc", NickName: "公众号"})
+	s.Put(padchat.Contact{UserName: "wxid_a", NickName: "张三", QuanPin: "zhangsan", PyInitial: "ZS", Label: "1,2"})
+	s.Put(padchat.Contact{UserName: "wxid_b", NickName: "李四", Remark: "老李", RemarkQuanPin: "laoli", Label: "3"})
+	s.Remove("gh_abc")
+	s.Remove("gh_abc")
+
+	require.Len(t, changes, 6)
+	assert.Equal(t, padchat.ContactAdded, changes[0].Type)
+	assert.Equal(t, padchat.ContactUpdated, changes[4].Type)
+	assert.Equal(t, "2", changes[4].Old.Label)
+	assert.Equal(t, "3", changes[4].New.Label)
+	assert.Equal(t, padchat.ContactRemoved, changes[5].Type)
+	assert.Equal(t, "gh_abc", changes[5].Old.UserName)
+
+	assert.Equal(t, 3, s.Len())
+	c, ok := s.Get("wxid_a")
+	require.True(t, ok)
+	assert.Equal(t, "张三", c.NickName)
+	assert.Equal(t, []string{"wxid_a", "wxid_b"}, userNames(s.Friends()))
+	assert.Equal(t, []string{"123@chatroom"}, userNames(s.Rooms()))
+	assert.Empty(t, s.Officials())
+	assert.Equal(t, padchat.ContactOfficial, padchat.Contact{UserName: "gh_abc"}.Kind())
+	assert.Equal(t, []string{"wxid_b"}, userNames(s.FindByNickName("李四")))
+	assert.Equal(t, []string{"wxid_b"}, userNames(s.FindByRemark("老李")))
+	assert.Equal(t, []string{"wxid_a"}, userNames(s.FindByPinyin("zs")))
+	assert.Equal(t, []string{"wxid_b"}, userNames(s.FindByPinyin("LAO")))
+	assert.Equal(t, []string{"wxid_a"}, userNames(s.FindByLabel(1)))
+	assert.Equal(t, []string{"123@chatroom"}, userNames(s.RoomsOf("wxid_c")))
+	assert.Len(t, s.RoomMembers("123@chatroom"), 2)
+
+	s.SetRoomMembers("123@chatroom", []padchat.ChatMemberInfo{{UserName: "wxid_d", NickName: "d"}})
+	assert.Equal(t, "d", s.RoomMembers("123@chatroom")[0].NickName)
+	assert.Empty(t, s.RoomsOf("wxid_c"))
+}
+
+func TestBotContacts(t *testing.T) {
+	bot, s := newTestBot(t)
+	login(t, bot)
+	added := make(chan string, 4)
+	bot.Contacts().OnChange(func(c padchat.ContactChange) {
+		if c.Type == padchat.ContactAdded {
+			added <- c.New.UserName
+		}
+	})
+	require.NoError(t, s.PushContact(padchat.Contact{UserName: "wxid_a"}))
+	assert.Equal(t, "wxid_a", <-added)
+
+	s.Reply("getContact", padchat.Contact{UserName: "wxid_b", NickName: "b"})
+	_, err := bot.GetContact("wxid_b")
+	require.NoError(t, err)
+	assert.Equal(t, "wxid_b", <-added)
+
+	s.Reply("getRoomMembers", padchat.ChatroomInfo{Member: `[{"user_name":"wxid_a"}]`})
+	_, err = bot.GetRoomMembers("123@chatroom")
+	require.NoError(t, err)
+	assert.Len(t, bot.Contacts().RoomMembers("123@chatroom"), 1)
+
+	require.NoError(t, s.Emit(padchattest.PushEvent(padchattest.ContactDeletePush("wxid_a"))))
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := bot.Contacts().Get("wxid_a"); !ok {
+			break
+		}
+		require.True(t, time.Now().Before(deadline), "contact not removed")
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestContactChangePanic(t *testing.T) {
+	// 未关联 Bot 的联系人缓存同样捕获 panic
+	s := padchat.NewContactStore()
+	s.OnChange(func(padchat.ContactChange) { panic("boom") })
+	s.Put(padchat.Contact{UserName: "wxid_a"})
+	assert.Equal(t, 1, s.Len())
+
+	bot, _ := newTestBot(t)
+	panics := make(chan padchat.HandlerPanicEvent, 1)
+	bot.OnHandlerPanic(func(e padchat.HandlerPanicEvent) { panics <- e })
+	bot.Contacts().OnChange(func(padchat.ContactChange) { panic("boom") })
+	bot.Contacts().Put(padchat.Contact{UserName: "wxid_a"})
+	e := <-panics
+	assert.Equal(t, "boom", e.Value)
+	assert.Nil(t, e.Event)
+}
+
+func TestBotContactsOrder(t *testing.T) {
+	bot, s := newTestBot(t)
+	login(t, bot)
+	// 每条推送单独一帧, 联系人缓存需按接收顺序更新
+	const n = 100
+	changes := make(chan string, n)
+	bot.Contacts().OnChange(func(c padchat.ContactChange) { changes <- c.New.NickName })
+	events := make([]padchattest.Event, n)
+	for i := range events {
+		events[i] = padchattest.PushEvent(padchattest.ContactPush(padchat.Contact{
+			UserName: "wxid_a",
+			NickName: strconv.Itoa(i),
+		}))
+	}
+	require.NoError(t, s.Emit(events...))
+	for i := 0; i < n; i++ {
+		select {
+		case name := <-changes:
+			require.Equal(t, strconv.Itoa(i), name)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d changes, want %d", i, n)
+		}
+	}
+}
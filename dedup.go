@@ -0,0 +1,232 @@
+package padchat
+
+import (
+	"bufio"
+	"container/list"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultDedupSize 去重记录的默认数量上限
+const defaultDedupSize = 10000
+
+// DedupStore 消息去重记录, 通过 WithDedup 开启去重后,
+// 已记录的 MsgID 再次推送时不会触发 OnMsg 回调
+type DedupStore interface {
+	// Seen 记录 id, id 已被记录且未过期时返回 true, 需支持并发调用
+	Seen(id string) (bool, error)
+}
+
+// MemoryDedupStore 内存中的去重记录, 超出数量上限时淘汰最久未出现的记录
+type MemoryDedupStore struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type dedupEntry struct {
+	id string
+	at time.Time
+}
+
+// NewMemoryDedupStore 新建内存去重记录, size 为记录数量上限, 默认为 10000,
+// ttl 为记录有效期, 为 0 时只按数量淘汰
+func NewMemoryDedupStore(size int, ttl time.Duration) *MemoryDedupStore {
+	if size <= 0 {
+		size = defaultDedupSize
+	}
+	return &MemoryDedupStore{
+		size:  size,
+		ttl:   ttl,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Seen 实现 DedupStore
+func (s *MemoryDedupStore) Seen(id string) (bool, error) {
+	return s.seen(id, time.Now()), nil
+}
+
+func (s *MemoryDedupStore) seen(id string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[id]; ok {
+		s.ll.MoveToFront(el)
+		e := el.Value.(*dedupEntry)
+		if s.ttl <= 0 || now.Sub(e.at) < s.ttl {
+			return true
+		}
+		e.at = now
+		return false
+	}
+	s.add(id, now)
+	return false
+}
+
+// add 添加记录并淘汰超出上限的记录, 调用方需持有锁
+func (s *MemoryDedupStore) add(id string, at time.Time) {
+	if el, ok := s.items[id]; ok {
+		el.Value.(*dedupEntry).at = at
+		s.ll.MoveToFront(el)
+		return
+	}
+	s.items[id] = s.ll.PushFront(&dedupEntry{id: id, at: at})
+	for s.ll.Len() > s.size {
+		el := s.ll.Back()
+		s.ll.Remove(el)
+		delete(s.items, el.Value.(*dedupEntry).id)
+	}
+}
+
+// entries 按从旧到新的顺序返回未过期的记录
+func (s *MemoryDedupStore) entries(now time.Time) []dedupEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]dedupEntry, 0, s.ll.Len())
+	for el := s.ll.Back(); el != nil; el = el.Prev() {
+		e := el.Value.(*dedupEntry)
+		if s.ttl <= 0 || now.Sub(e.at) < s.ttl {
+			out = append(out, *e)
+		}
+	}
+	return out
+}
+
+// FileDedupStore 保存到文件的去重记录, 程序重启后仍然有效
+// 记录以追加方式写入文件, 文件过大时按内存中的记录重写
+type FileDedupStore struct {
+	mu    sync.Mutex
+	path  string
+	mem   *MemoryDedupStore
+	file  *os.File
+	lines int
+}
+
+// NewFileDedupStore 打开或新建文件去重记录, size 和 ttl 同 NewMemoryDedupStore
+// 使用完毕后需调用 Close
+func NewFileDedupStore(path string, size int, ttl time.Duration) (*FileDedupStore, error) {
+	s := &FileDedupStore{
+		path: path,
+		mem:  NewMemoryDedupStore(size, ttl),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load 从文件读取记录, 每行格式为 `id\tunix纳秒`
+func (s *FileDedupStore) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		id, at, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+		nano, err := strconv.ParseInt(at, 10, 64)
+		if err != nil {
+			continue
+		}
+		s.mem.add(id, time.Unix(0, nano))
+	}
+	return scanner.Err()
+}
+
+// Seen 实现 DedupStore
+func (s *FileDedupStore) Seen(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return false, os.ErrClosed
+	}
+	now := time.Now()
+	if s.mem.seen(id, now) {
+		return true, nil
+	}
+	if _, err := fmt.Fprintf(s.file, "%s\t%d\n", id, now.UnixNano()); err != nil {
+		return false, err
+	}
+	s.lines++
+	if s.lines > 2*s.mem.size {
+		return false, s.compact()
+	}
+	return false, nil
+}
+
+// compact 将内存中的记录写入临时文件并替换原文件, 调用方需持有锁.
+// 失败时继续使用原文件, 之后会再次尝试
+func (s *FileDedupStore) compact() error {
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	entries := s.mem.entries(time.Now())
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%d\n", e.id, e.at.UnixNano())
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	// 替换成功后才关闭原文件, 临时文件的句柄在重命名后继续用于追加
+	if err := os.Rename(tmp, s.path); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = f
+	s.lines = len(entries)
+	return nil
+}
+
+// Close 关闭文件
+func (s *FileDedupStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// isDuplicate 开启去重时检查消息是否已处理过, 去重记录出错时按未处理过处理
+func (bot *Bot) isDuplicate(msg Msg) bool {
+	if bot.dedup == nil || msg.MsgID == "" {
+		return false
+	}
+	seen, err := bot.dedup.Seen(msg.MsgID)
+	if err != nil {
+		bot.logger.Warn("dedup store failed", "msg_id", msg.MsgID, "error", err)
+		return false
+	}
+	if seen {
+		bot.logger.Debug("duplicate msg", "msg_id", msg.MsgID)
+	}
+	return seen
+}
@@ -0,0 +1,108 @@
+package padchat_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuotoo/padchat"
+)
+
+func seen(t *testing.T, s padchat.DedupStore, id string) bool {
+	ok, err := s.Seen(id)
+	require.NoError(t, err)
+	return ok
+}
+
+func TestMemoryDedupStore(t *testing.T) {
+	s := padchat.NewMemoryDedupStore(2, 0)
+	assert.False(t, seen(t, s, "1"))
+	assert.True(t, seen(t, s, "1"))
+	assert.False(t, seen(t, s, "2"))
+	assert.True(t, seen(t, s, "1"))
+	assert.False(t, seen(t, s, "3"))
+	assert.False(t, seen(t, s, "2"), "least recently seen id evicted")
+	assert.True(t, seen(t, s, "3"))
+
+	s = padchat.NewMemoryDedupStore(10, 20*time.Millisecond)
+	assert.False(t, seen(t, s, "1"))
+	assert.True(t, seen(t, s, "1"))
+	time.Sleep(30 * time.Millisecond)
+	assert.False(t, seen(t, s, "1"), "expired id")
+}
+
+func TestFileDedupStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup")
+	s, err := padchat.NewFileDedupStore(path, 5, 0)
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		assert.False(t, seen(t, s, strconv.Itoa(i)))
+	}
+	assert.True(t, seen(t, s, "19"))
+	require.NoError(t, s.Close())
+
+	s, err = padchat.NewFileDedupStore(path, 5, 0)
+	require.NoError(t, err)
+	defer s.Close()
+	assert.True(t, seen(t, s, "19"))
+	assert.True(t, seen(t, s, "15"))
+	assert.False(t, seen(t, s, "14"))
+}
+
+func TestDedup(t *testing.T) {
+	bot, s := newTestBot(t, padchat.WithDedup(padchat.NewMemoryDedupStore(0, 0)))
+	msgs := make(chan string, 4)
+	bot.OnMsg(func(m padchat.Msg) { msgs <- m.MsgID })
+	require.NoError(t, s.PushMsg(
+		padchat.Msg{FromUser: "wxid_a", MsgID: "1"},
+		padchat.Msg{FromUser: "wxid_a", MsgID: "1"},
+		padchat.Msg{FromUser: "wxid_a", MsgID: "2"},
+	))
+	require.NoError(t, s.PushMsg(padchat.Msg{FromUser: "wxid_a", MsgID: "2"}))
+	got := []string{<-msgs, <-msgs}
+	assert.ElementsMatch(t, []string{"1", "2"}, got)
+	select {
+	case id := <-msgs:
+		t.Fatalf("duplicate msg %s delivered", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestFileDedupStoreCompactFailed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup")
+	s, err := padchat.NewFileDedupStore(path, 2, 0)
+	require.NoError(t, err)
+	// 临时文件路径被目录占用时无法压缩, 记录仍写入原文件
+	require.NoError(t, os.Mkdir(path+".tmp", 0o755))
+	var failed bool
+	for i := 0; i < 10; i++ {
+		_, err := s.Seen(strconv.Itoa(i))
+		failed = failed || err != nil
+	}
+	assert.True(t, failed)
+	require.NoError(t, s.Close())
+
+	require.NoError(t, os.Remove(path+".tmp"))
+	s, err = padchat.NewFileDedupStore(path, 2, 0)
+	require.NoError(t, err)
+	defer s.Close()
+	assert.True(t, seen(t, s, "9"))
+}
+
+func TestDedupDefault(t *testing.T) {
+	bot, s := newTestBot(t, padchat.WithDedup(nil))
+	msgs := make(chan string, 4)
+	bot.OnMsg(func(m padchat.Msg) { msgs <- m.MsgID })
+	require.NoError(t, s.PushMsg(padchat.Msg{MsgID: "1"}, padchat.Msg{MsgID: "1"}, padchat.Msg{MsgID: "2"}))
+	assert.ElementsMatch(t, []string{"1", "2"}, []string{<-msgs, <-msgs})
+	select {
+	case id := <-msgs:
+		t.Fatalf("duplicate msg %s", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,161 @@
+package padchat
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// OverflowPolicy 执行回调的队列已满时的处理方式
+type OverflowPolicy int
+
+const (
+	// OverflowBlock 阻塞等待队列空出位置, 会阻塞读取服务端数据,
+	// 回调中执行的指令可能因无法读取返回而超时, 需设置足够大的队列
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest 丢弃队列中最早的事件
+	OverflowDropOldest
+	// OverflowError 丢弃新的事件
+	OverflowError
+)
+
+// DeliveryConfig 有序分发配置
+type DeliveryConfig struct {
+	// Workers 并发执行回调的 worker 数量, 默认为 4
+	// 同一会话的事件总是由同一个 worker 按接收顺序处理
+	Workers int
+	// QueueSize 每个 worker 的队列长度, 默认为 256
+	QueueSize int
+	// Overflow 队列已满时的处理方式, 默认为 OverflowBlock
+	Overflow OverflowPolicy
+	// OnOverflow 事件被丢弃时回调, err 为 ErrQueueFull
+	// OverflowDropOldest 时 e 为被丢弃的旧事件, OverflowError 时 e 为新事件
+	OnOverflow func(e Event, err error)
+}
+
+// eventDelivery 执行回调的事件队列和 worker
+// 有序分发时按会话分片, 每个分片一个 worker; 否则所有 worker 共用一个队列
+type eventDelivery struct {
+	cfg     DeliveryConfig
+	ordered bool
+	shards  []chan Event
+	// mu 保证 closed 后不再写入 shards
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newEventDelivery(cfg DeliveryConfig, ordered bool) *eventDelivery {
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultEventWorkers
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultEventQueueSize
+	}
+	n := 1
+	if ordered {
+		n = cfg.Workers
+	}
+	d := &eventDelivery{
+		cfg:     cfg,
+		ordered: ordered,
+		shards:  make([]chan Event, n),
+	}
+	for i := range d.shards {
+		d.shards[i] = make(chan Event, cfg.QueueSize)
+	}
+	return d
+}
+
+// start 启动 worker, worker 计入 wg
+func (d *eventDelivery) start(wg *sync.WaitGroup, handle func(Event)) {
+	n := 1
+	if !d.ordered {
+		n = d.cfg.Workers
+	}
+	wg.Add(len(d.shards) * n)
+	for _, ch := range d.shards {
+		for i := 0; i < n; i++ {
+			go func(ch chan Event) {
+				defer wg.Done()
+				for e := range ch {
+					handle(e)
+				}
+			}(ch)
+		}
+	}
+}
+
+// push 将事件放入所属会话的分片, 不区分会话时只有一个分片
+func (d *eventDelivery) push(e Event) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return
+	}
+	ch := d.shards[shardOf(eventKey(e), len(d.shards))]
+	switch d.cfg.Overflow {
+	case OverflowDropOldest:
+		for {
+			select {
+			case ch <- e:
+				return
+			default:
+			}
+			select {
+			case old := <-ch:
+				d.overflow(old)
+			default:
+			}
+		}
+	case OverflowError:
+		select {
+		case ch <- e:
+		default:
+			d.overflow(e)
+		}
+	default:
+		ch <- e
+	}
+}
+
+func (d *eventDelivery) overflow(e Event) {
+	if d.cfg.OnOverflow != nil {
+		d.cfg.OnOverflow(e, ErrQueueFull)
+	}
+}
+
+// close 关闭所有分片, worker 处理完队列中的事件后退出
+func (d *eventDelivery) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+	d.closed = true
+	for _, ch := range d.shards {
+		close(ch)
+	}
+}
+
+// eventKey 返回事件所属的会话, 群消息为群 ID, 其他消息为 FromUser
+func eventKey(e Event) string {
+	switch e := e.(type) {
+	case MsgEvent:
+		if id := e.Msg.GroupID(); id != "" {
+			return id
+		}
+		return e.Msg.FromUser
+	case ContactSyncEvent:
+		return e.Contact.UserName
+	case ContactDeleteEvent:
+		return e.UserName
+	case RoomMemberChangeEvent:
+		return e.RoomID
+	}
+	return ""
+}
+
+func shardOf(key string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
@@ -0,0 +1,90 @@
+package padchat_test
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuotoo/padchat"
+)
+
+func TestOrderedDelivery(t *testing.T) {
+	const n = 100
+	bot, s := newTestBot(t, padchat.WithOrderedDelivery(padchat.DeliveryConfig{Workers: 3}))
+	var mu sync.Mutex
+	got := make(map[string][]int)
+	var wg sync.WaitGroup
+	wg.Add(2 * n)
+	bot.OnMsg(func(m padchat.Msg) {
+		defer wg.Done()
+		id, _ := strconv.Atoi(m.MsgID)
+		mu.Lock()
+		got[m.FromUser] = append(got[m.FromUser], id)
+		mu.Unlock()
+	})
+	for i := 0; i < n; i++ {
+		require.NoError(t, s.PushMsg(
+			padchat.Msg{FromUser: "wxid_a", MsgID: strconv.Itoa(i)},
+			padchat.Msg{FromUser: "123@chatroom", MsgID: strconv.Itoa(i)},
+		))
+	}
+	wg.Wait()
+	for _, user := range []string{"wxid_a", "123@chatroom"} {
+		ids := got[user]
+		require.Len(t, ids, n)
+		for i, id := range ids {
+			assert.Equal(t, i, id, user)
+		}
+	}
+}
+
+func TestDeliveryOverflow(t *testing.T) {
+	for _, policy := range []padchat.OverflowPolicy{padchat.OverflowDropOldest, padchat.OverflowError} {
+		dropped := make(chan string, 10)
+		bot, s := newTestBot(t, padchat.WithOrderedDelivery(padchat.DeliveryConfig{
+			Workers:   1,
+			QueueSize: 1,
+			Overflow:  policy,
+			OnOverflow: func(e padchat.Event, err error) {
+				assert.True(t, errors.Is(err, padchat.ErrQueueFull))
+				dropped <- e.(padchat.MsgEvent).Msg.MsgID
+			},
+		}))
+		started := make(chan struct{})
+		release := make(chan struct{})
+		handled := make(chan string, 10)
+		bot.OnMsg(func(m padchat.Msg) {
+			if m.MsgID == "0" {
+				close(started)
+				<-release
+			}
+			handled <- m.MsgID
+		})
+		require.NoError(t, s.PushMsg(padchat.Msg{FromUser: "wxid_a", MsgID: "0"}))
+		<-started
+		require.NoError(t, s.PushMsg(
+			padchat.Msg{FromUser: "wxid_a", MsgID: "1"},
+			padchat.Msg{FromUser: "wxid_a", MsgID: "2"},
+		))
+		var drop string
+		select {
+		case drop = <-dropped:
+		case <-time.After(time.Second):
+			t.Fatal("overflow not reported")
+		}
+		close(release)
+		assert.Equal(t, "0", <-handled)
+		if policy == padchat.OverflowDropOldest {
+			assert.Equal(t, "1", drop)
+			assert.Equal(t, "2", <-handled)
+		} else {
+			assert.Equal(t, "2", drop)
+			assert.Equal(t, "1", <-handled)
+		}
+	}
+}
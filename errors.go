@@ -0,0 +1,97 @@
+package padchat
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrTimeout 指令在 SetCommandTimeout 设置的时间内未返回
+	ErrTimeout = errors.New("padchat: command timeout")
+	// ErrNotLoggedIn 微信未登录, 无法执行需要登录的指令
+	ErrNotLoggedIn = errors.New("padchat: not logged in")
+	// ErrConnClosed ws 连接已关闭
+	ErrConnClosed = errors.New("padchat: connection closed")
+	// ErrServerStatus 服务端返回的 status 不为 0
+	ErrServerStatus = errors.New("padchat: server status error")
+	// ErrQueueFull 有序分发的队列已满, 事件被丢弃
+	ErrQueueFull = errors.New("padchat: event queue full")
+	// ErrAccountExists Manager 中已存在相同 ID 的账号
+	ErrAccountExists = errors.New("padchat: account already exists")
+	// ErrAccountNotFound Manager 中不存在该账号
+	ErrAccountNotFound = errors.New("padchat: account not found")
+	// ErrQRExpired 登录二维码已过期
+	ErrQRExpired = errors.New("padchat: qr code expired")
+	// ErrLoginCanceled 手机端取消了登录
+	ErrLoginCanceled = errors.New("padchat: login canceled")
+	// ErrPasswordWrong 账号或密码错误
+	ErrPasswordWrong = errors.New("padchat: wrong password")
+	// ErrLoginFailed 登录失败, 具体原因见 LoginError.Msg
+	ErrLoginFailed = errors.New("padchat: login failed")
+	// ErrOutboxFull Outbox 中排队的消息数量已达到 QueueSize
+	ErrOutboxFull = errors.New("padchat: outbox full")
+	// ErrOutboxClosed Outbox 已关闭
+	ErrOutboxClosed = errors.New("padchat: outbox closed")
+)
+
+// Error 指令执行失败时返回的错误, 可使用 errors.Is 判断 Err 中的哨兵错误,
+// 或使用 errors.As 获取指令名称和服务端返回信息
+type Error struct {
+	// Cmd 指令名称
+	Cmd string
+	// CmdID 指令 ID
+	CmdID string
+	// Msg 服务端返回的错误信息
+	Msg string
+	// Status 服务端返回的状态码
+	Status int
+	// Err 错误原因, 如 ErrTimeout, ErrServerStatus, context.Canceled
+	Err error
+}
+
+func (e *Error) Error() string {
+	msg := e.Msg
+	if msg == "" && e.Err != nil {
+		msg = e.Err.Error()
+	}
+	if e.Status != 0 {
+		return fmt.Sprintf("padchat: %s [%s]: %s (status %d)", e.Cmd, e.CmdID, msg, e.Status)
+	}
+	return fmt.Sprintf("padchat: %s [%s]: %s", e.Cmd, e.CmdID, msg)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// statusResp 带有 status 和 message 字段的指令返回数据
+type statusResp interface {
+	respStatus() (status int, message string)
+}
+
+func (r *SendMsgResp) respStatus() (int, string)      { return r.Status, r.Message }
+func (r *MsgImageResp) respStatus() (int, string)     { return r.Status, r.Message }
+func (r *MsgVideoResp) respStatus() (int, string)     { return r.Status, r.Message }
+func (r *MsgVoiceResp) respStatus() (int, string)     { return r.Status, r.Message }
+func (r *ChatroomInfo) respStatus() (int, string)     { return r.Status, r.Message }
+func (r *CreateRoomResp) respStatus() (int, string)   { return r.Status, r.Message }
+func (r *MsgAndStatus) respStatus() (int, string)     { return r.Status, r.Message }
+func (r *QRCodeResp) respStatus() (int, string)       { return r.Status, r.Message }
+func (r *ImgResp) respStatus() (int, string)          { return r.Status, r.Message }
+func (r *SNSUploadResp) respStatus() (int, string)    { return r.Status, r.Message }
+func (r *MomentResp) respStatus() (int, string)       { return r.Status, r.Message }
+func (r *MomentListResp) respStatus() (int, string)   { return r.Status, r.Message }
+func (r *MomentDetailResp) respStatus() (int, string) { return r.Status, r.Message }
+func (r *FavListResp) respStatus() (int, string)      { return r.Status, r.Message }
+func (r *AddFavResp) respStatus() (int, string)       { return r.Status, r.Message }
+func (r *FavResp) respStatus() (int, string)          { return r.Status, r.Message }
+func (r *LabelListResp) respStatus() (int, string)    { return r.Status, r.Message }
+func (r *ExternalMsgResp) respStatus() (int, string)  { return r.Status, r.Message }
+func (r *SearchMPResp) respStatus() (int, string)     { return r.Status, r.Message }
+func (r *RequestTokenResp) respStatus() (int, string) { return r.Status, r.Message }
+func (r *RequestUrlResp) respStatus() (int, string)   { return r.Status, r.Message }
+
+// decodedResp 解析后还需进一步处理的指令返回数据
+type decodedResp interface {
+	decoded() error
+}
@@ -0,0 +1,30 @@
+package padchat_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuotoo/padchat"
+)
+
+func TestError(t *testing.T) {
+	var err error = &padchat.Error{
+		Cmd:    "sendMsg",
+		CmdID:  "1",
+		Msg:    "fail",
+		Status: -1,
+		Err:    padchat.ErrServerStatus,
+	}
+	assert.Equal(t, "padchat: sendMsg [1]: fail (status -1)", err.Error())
+	assert.True(t, errors.Is(err, padchat.ErrServerStatus))
+	var e *padchat.Error
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, -1, e.Status)
+
+	err = &padchat.Error{Cmd: "init", CmdID: "2", Err: context.Canceled}
+	assert.Equal(t, "padchat: init [2]: context canceled", err.Error())
+	assert.True(t, errors.Is(err, context.Canceled))
+}
@@ -0,0 +1,342 @@
+package padchat
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// Event Bot 产生的事件, 可通过 type switch 获取具体类型
+type Event interface {
+	event()
+}
+
+// QRURLEvent 收到登录二维码
+type QRURLEvent struct {
+	URL string
+}
+
+// ScanEvent 二维码扫描状态变化
+type ScanEvent struct {
+	Scan ScanResp
+}
+
+// MsgEvent 收到微信消息
+type MsgEvent struct {
+	Msg Msg
+}
+
+// LoginEvent 登录成功
+type LoginEvent struct{}
+
+// LoadedEvent 联系人加载完成
+type LoadedEvent struct{}
+
+// ContactSyncEvent 联系人同步
+type ContactSyncEvent struct {
+	Contact Contact
+}
+
+// WarnEvent 服务端警告
+type WarnEvent struct {
+	Warn string
+}
+
+// DisconnectEvent ws 连接异常断开
+type DisconnectEvent struct {
+	Err error
+}
+
+// ReconnectEvent 断线重连成功
+type ReconnectEvent struct{}
+
+// StateChangeEvent 连接状态变化
+type StateChangeEvent struct {
+	From, To State
+}
+
+// UnknownEvent 无法识别的服务端数据或用户事件
+type UnknownEvent struct {
+	Data ServerData
+}
+
+// UnknownPushEvent 无法识别 msg_type 的推送
+type UnknownPushEvent struct {
+	Push json.RawMessage
+}
+
+// HandlerPanicEvent 回调发生 panic
+type HandlerPanicEvent struct {
+	// Event 回调处理的事件, OnClose, ContactStore.OnChange 和 Outbox.OnResult 回调中的 panic 为 nil
+	Event Event
+	// Value recover 得到的值
+	Value interface{}
+	// Stack 发生 panic 时的调用栈
+	Stack []byte
+}
+
+func (QRURLEvent) event()        {}
+func (ScanEvent) event()         {}
+func (MsgEvent) event()          {}
+func (LoginEvent) event()        {}
+func (LoadedEvent) event()       {}
+func (ContactSyncEvent) event()  {}
+func (WarnEvent) event()         {}
+func (DisconnectEvent) event()   {}
+func (ReconnectEvent) event()    {}
+func (StateChangeEvent) event()  {}
+func (UnknownEvent) event()      {}
+func (UnknownPushEvent) event()  {}
+func (HandlerPanicEvent) event() {}
+
+// handlerList 同一事件的回调列表, 按注册顺序执行
+type handlerList[F any] struct {
+	mu      sync.Mutex
+	nextID  uint64
+	entries []handlerEntry[F]
+}
+
+type handlerEntry[F any] struct {
+	id uint64
+	f  F
+}
+
+// add 添加回调, 返回取消注册的函数, 重复调用取消函数无副作用
+func (l *handlerList[F]) add(f F) func() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.nextID++
+	id := l.nextID
+	// 写时复制, each 持有的快照不受影响
+	entries := make([]handlerEntry[F], len(l.entries), len(l.entries)+1)
+	copy(entries, l.entries)
+	l.entries = append(entries, handlerEntry[F]{id: id, f: f})
+	return func() {
+		l.remove(id)
+	}
+}
+
+func (l *handlerList[F]) remove(id uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, e := range l.entries {
+		if e.id == id {
+			entries := make([]handlerEntry[F], 0, len(l.entries)-1)
+			entries = append(entries, l.entries[:i]...)
+			l.entries = append(entries, l.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// empty 是否没有注册回调
+func (l *handlerList[F]) empty() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries) == 0
+}
+
+// each 依次执行当前注册的回调, 回调中可以注册或取消注册
+// 回调发生 panic 时交给 onPanic 处理, 不影响后续回调, onPanic 为 nil 时不捕获
+func (l *handlerList[F]) each(call func(F), onPanic func(v interface{}, stack []byte)) {
+	l.mu.Lock()
+	entries := l.entries
+	l.mu.Unlock()
+	for _, e := range entries {
+		if onPanic == nil {
+			call(e.f)
+			continue
+		}
+		func() {
+			defer func() {
+				if v := recover(); v != nil {
+					onPanic(v, debug.Stack())
+				}
+			}()
+			call(e.f)
+		}()
+	}
+}
+
+// eventHandlers Bot 各事件的回调
+type eventHandlers struct {
+	qrURL       handlerList[func(string)]
+	scan        handlerList[func(ScanResp)]
+	msg         handlerList[func(Msg)]
+	login       handlerList[func()]
+	loaded      handlerList[func()]
+	contactSync handlerList[func(Contact)]
+	warn        handlerList[func(string)]
+	disconnect  handlerList[func(error)]
+	reconnect   handlerList[func()]
+	stateChange handlerList[func(from, to State)]
+	unknownEvt  handlerList[func(ServerData)]
+	unknownPush handlerList[func(json.RawMessage)]
+	panic       handlerList[func(HandlerPanicEvent)]
+
+	contactDelete handlerList[func(string)]
+	roomMember    handlerList[func(RoomMemberChangeEvent)]
+	selfProfile   handlerList[func(Contact)]
+	syncFinished  handlerList[func(msgType, cont int)]
+	rawPush       handlerList[func(json.RawMessage)]
+
+	// watch 在回调前按接收顺序同步执行, 供 waitLogin 等内部流程使用
+	watch handlerList[func(Event)]
+}
+
+// dispatch 按接收顺序将事件发送到 Events 返回的 channel, 再放入执行回调的队列,
+// 开启有序分发时放入所属会话的队列, 队列已满时阻塞, Shutdown 时会等待所有回调执行完毕
+func (bot *Bot) dispatch(e Event) {
+	bot.watch(e)
+	bot.publish(e)
+	bot.delivery.push(e)
+}
+
+// watch 在当前协程中将事件交给内部流程, 用户事件由唯一的 worker 调用, 保证顺序
+func (bot *Bot) watch(e Event) {
+	bot.subs.watch.each(func(f func(Event)) { f(e) }, nil)
+}
+
+// notify 在当前协程中执行事件的回调, 并发送到 Events 返回的 channel
+func (bot *Bot) notify(e Event) {
+	bot.runHandlers(e)
+	bot.publish(e)
+}
+
+// runHandlers 在当前协程中执行事件的回调
+func (bot *Bot) runHandlers(e Event) {
+	h := &bot.subs
+	onPanic := func(v interface{}, stack []byte) {
+		bot.handlerPanic(e, v, stack)
+	}
+	switch e := e.(type) {
+	case QRURLEvent:
+		h.qrURL.each(func(f func(string)) { f(e.URL) }, onPanic)
+	case ScanEvent:
+		h.scan.each(func(f func(ScanResp)) { f(e.Scan) }, onPanic)
+	case MsgEvent:
+		h.msg.each(func(f func(Msg)) { f(e.Msg) }, onPanic)
+	case LoginEvent:
+		h.login.each(func(f func()) { f() }, onPanic)
+	case LoadedEvent:
+		h.loaded.each(func(f func()) { f() }, onPanic)
+	case ContactSyncEvent:
+		h.contactSync.each(func(f func(Contact)) { f(e.Contact) }, onPanic)
+	case WarnEvent:
+		h.warn.each(func(f func(string)) { f(e.Warn) }, onPanic)
+	case DisconnectEvent:
+		h.disconnect.each(func(f func(error)) { f(e.Err) }, onPanic)
+	case ReconnectEvent:
+		h.reconnect.each(func(f func()) { f() }, onPanic)
+	case StateChangeEvent:
+		h.stateChange.each(func(f func(from, to State)) { f(e.From, e.To) }, onPanic)
+	case UnknownEvent:
+		h.unknownEvt.each(func(f func(ServerData)) { f(e.Data) }, onPanic)
+	case UnknownPushEvent:
+		h.unknownPush.each(func(f func(json.RawMessage)) { f(e.Push) }, onPanic)
+	case ContactDeleteEvent:
+		h.contactDelete.each(func(f func(string)) { f(e.UserName) }, onPanic)
+	case RoomMemberChangeEvent:
+		h.roomMember.each(func(f func(RoomMemberChangeEvent)) { f(e) }, onPanic)
+	case SelfProfileUpdateEvent:
+		h.selfProfile.each(func(f func(Contact)) { f(e.Profile) }, onPanic)
+	case SyncFinishedEvent:
+		h.syncFinished.each(func(f func(msgType, cont int)) { f(e.MsgType, e.Continue) }, onPanic)
+	case RawPushEvent:
+		h.rawPush.each(func(f func(json.RawMessage)) { f(e.Push) }, onPanic)
+	case HandlerPanicEvent:
+		// OnHandlerPanic 回调中的 panic 只记录日志, 避免递归
+		h.panic.each(func(f func(HandlerPanicEvent)) { f(e) }, func(v interface{}, stack []byte) {
+			bot.logger.Error("panic handler panic", "panic", v, "stack", string(stack))
+		})
+	}
+}
+
+// handlerPanic 记录回调中的 panic 并交给 OnHandlerPanic 回调
+func (bot *Bot) handlerPanic(e Event, v interface{}, stack []byte) {
+	bot.logger.Error("handler panic", "event", fmt.Sprintf("%T", e), "panic", v, "stack", string(stack))
+	bot.notify(HandlerPanicEvent{Event: e, Value: v, Stack: stack})
+}
+
+// guard 执行不经过 notify 的用户回调, 同样捕获其中的 panic
+func (bot *Bot) guard(e Event, f func()) {
+	defer func() {
+		if v := recover(); v != nil {
+			bot.handlerPanic(e, v, debug.Stack())
+		}
+	}()
+	f()
+}
+
+// OnHandlerPanic 回调发生 panic 时回调, 所有回调均会捕获 panic, 不会导致程序退出,
+// 未设置时只通过 Logger 记录
+func (bot *Bot) OnHandlerPanic(f func(e HandlerPanicEvent)) (unsubscribe func()) {
+	return bot.subs.panic.add(f)
+}
+
+// Events 返回接收所有事件的 channel, 可作为回调之外的另一种使用方式,
+// 多次调用返回同一个 channel, Shutdown 完成后关闭.
+// 事件按接收顺序写入, channel 满时会阻塞事件处理, 请及时读取, Shutdown 开始后无法写入的事件会被丢弃
+func (bot *Bot) Events() <-chan Event {
+	bot.eventChMu.RLock()
+	ch := bot.eventCh
+	bot.eventChMu.RUnlock()
+	if ch != nil {
+		return ch
+	}
+	bot.eventChMu.Lock()
+	defer bot.eventChMu.Unlock()
+	if bot.eventCh == nil {
+		bot.eventCh = make(chan Event, defaultEventQueueSize)
+		if bot.eventChClosed {
+			close(bot.eventCh)
+		}
+	}
+	return bot.eventCh
+}
+
+// hasEventsChan 是否已通过 Events 订阅所有事件
+func (bot *Bot) hasEventsChan() bool {
+	bot.eventChMu.RLock()
+	defer bot.eventChMu.RUnlock()
+	return bot.eventCh != nil && !bot.eventChClosed
+}
+
+// publish 将事件写入 Events 返回的 channel, 写入时不持有 eventChMu,
+// 避免 channel 已满时阻塞调用 Events 的读取方
+func (bot *Bot) publish(e Event) {
+	bot.eventChMu.RLock()
+	ch := bot.eventCh
+	if ch == nil || bot.eventChClosed {
+		bot.eventChMu.RUnlock()
+		return
+	}
+	// 在锁内登记, closeEvents 会等待所有写入结束后再关闭 channel
+	bot.publishing.Add(1)
+	bot.eventChMu.RUnlock()
+	defer bot.publishing.Done()
+	select {
+	case ch <- e:
+		return
+	default:
+	}
+	select {
+	case ch <- e:
+	case <-bot.done:
+		bot.logger.Debug("event dropped", "event", e)
+	}
+}
+
+// closeEvents 关闭 Events 返回的 channel, 需在所有回调执行完毕后调用
+func (bot *Bot) closeEvents() {
+	bot.eventChMu.Lock()
+	bot.eventChClosed = true
+	ch := bot.eventCh
+	bot.eventChMu.Unlock()
+	// 此时 bot.done 已关闭, 阻塞中的写入会直接返回
+	bot.publishing.Wait()
+	if ch != nil {
+		close(ch)
+	}
+}
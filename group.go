@@ -0,0 +1,84 @@
+package padchat
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// chatroomSuffix 群 ID 的后缀
+const chatroomSuffix = "@chatroom"
+
+// AtAll @所有人 时 atuserlist 中的 ID
+const AtAll = "notify@all"
+
+// IsGroup 是否为群消息
+func (m Msg) IsGroup() bool {
+	return m.GroupID() != ""
+}
+
+// GroupID 返回群消息所在群的 ID, 非群消息返回空
+func (m Msg) GroupID() string {
+	if strings.HasSuffix(m.FromUser, chatroomSuffix) {
+		return m.FromUser
+	}
+	if strings.HasSuffix(m.ToUser, chatroomSuffix) {
+		return m.ToUser
+	}
+	return ""
+}
+
+// SenderID 返回消息发送者的 ID
+// 收到的群消息中 FromUser 为群 ID, 发送者 ID 以 `wxid:\n` 的形式附在 Content 前
+func (m Msg) SenderID() string {
+	if !strings.HasSuffix(m.FromUser, chatroomSuffix) {
+		return m.FromUser
+	}
+	sender, _ := splitSender(m.contentString())
+	return sender
+}
+
+// Body 返回去除了群消息发送者前缀的消息内容
+func (m Msg) Body() string {
+	content := m.contentString()
+	if !strings.HasSuffix(m.FromUser, chatroomSuffix) {
+		return content
+	}
+	_, body := splitSender(content)
+	return body
+}
+
+// AtList 返回消息中被 @ 的用户 ID, @所有人 时包含 AtAll
+func (m Msg) AtList() []string {
+	src := &struct {
+		AtUserList string `xml:"atuserlist"`
+	}{}
+	if err := xml.Unmarshal([]byte(m.MsgSource), src); err != nil {
+		return nil
+	}
+	var list []string
+	for _, id := range strings.Split(src.AtUserList, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			list = append(list, id)
+		}
+	}
+	return list
+}
+
+// MentionsMe 消息是否 @ 了 botID, @所有人 不算在内
+func (m Msg) MentionsMe(botID string) bool {
+	for _, id := range m.AtList() {
+		if id == botID {
+			return true
+		}
+	}
+	return false
+}
+
+// splitSender 拆分群消息内容中的发送者 ID 和消息正文
+func splitSender(content string) (sender, body string) {
+	i := strings.Index(content, ":\n")
+	if i <= 0 || strings.ContainsAny(content[:i], " \n<") {
+		return "", content
+	}
+	return content[:i], content[i+2:]
+}
@@ -0,0 +1,40 @@
+package padchat_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuotoo/padchat"
+)
+
+func TestGroupMsg(t *testing.T) {
+	msg := newMsg(padchat.MsgTypeText, "wxid_b:\n@bot hello")
+	msg.FromUser = "123@chatroom"
+	msg.ToUser = "wxid_bot"
+	msg.MsgSource = `<msgsource><atuserlist><![CDATA[,wxid_bot,wxid_c]]></atuserlist></msgsource>`
+	assert.True(t, msg.IsGroup())
+	assert.Equal(t, "123@chatroom", msg.GroupID())
+	assert.Equal(t, "wxid_b", msg.SenderID())
+	assert.Equal(t, "@bot hello", msg.Body())
+	assert.Equal(t, []string{"wxid_bot", "wxid_c"}, msg.AtList())
+	assert.True(t, msg.MentionsMe("wxid_bot"))
+	assert.False(t, msg.MentionsMe("wxid_d"))
+	m, err := padchat.ParseMsg(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, "@bot hello", m.(padchat.TextMsg).Text)
+
+	msg = newMsg(padchat.MsgTypeText, "hi:\nthere")
+	msg.ToUser = "wxid_bot"
+	assert.False(t, msg.IsGroup())
+	assert.Equal(t, "wxid_a", msg.SenderID())
+	assert.Equal(t, "hi:\nthere", msg.Body())
+	assert.Nil(t, msg.AtList())
+
+	msg = newMsg(padchat.MsgTypeText, "hello")
+	msg.FromUser = "wxid_bot"
+	msg.ToUser = "123@chatroom"
+	assert.Equal(t, "123@chatroom", msg.GroupID())
+	assert.Equal(t, "wxid_bot", msg.SenderID())
+	assert.Equal(t, "hello", msg.Body())
+}
@@ -0,0 +1,88 @@
+package padchat
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+)
+
+// Logger 日志接口, keyvals 为交替的键值对, 与 slog 的参数形式一致
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+// NopLogger 丢弃所有日志, 为 Bot 的默认 Logger
+var NopLogger Logger = nopLogger{}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// SlogLogger 将 *slog.Logger 适配为 Logger
+func SlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s slogLogger) Debug(msg string, keyvals ...interface{}) { s.l.Debug(msg, keyvals...) }
+func (s slogLogger) Info(msg string, keyvals ...interface{})  { s.l.Info(msg, keyvals...) }
+func (s slogLogger) Warn(msg string, keyvals ...interface{})  { s.l.Warn(msg, keyvals...) }
+func (s slogLogger) Error(msg string, keyvals ...interface{}) { s.l.Error(msg, keyvals...) }
+
+// StdLogger 将 *log.Logger 适配为 Logger, 以 key=value 格式输出, 不输出 Debug 日志
+func StdLogger(l *log.Logger) Logger {
+	return stdLogger{l}
+}
+
+type stdLogger struct {
+	l *log.Logger
+}
+
+func (s stdLogger) Debug(string, ...interface{})             {}
+func (s stdLogger) Info(msg string, keyvals ...interface{})  { s.output("INFO", msg, keyvals) }
+func (s stdLogger) Warn(msg string, keyvals ...interface{})  { s.output("WARN", msg, keyvals) }
+func (s stdLogger) Error(msg string, keyvals ...interface{}) { s.output("ERROR", msg, keyvals) }
+
+func (s stdLogger) output(level, msg string, keyvals []interface{}) {
+	var b strings.Builder
+	b.WriteString(level)
+	b.WriteString(" ")
+	b.WriteString(msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		if i+1 < len(keyvals) {
+			fmt.Fprintf(&b, " %v=%v", keyvals[i], keyvals[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", keyvals[i])
+		}
+	}
+	s.l.Output(3, b.String())
+}
+
+// withKeyvals 返回在每条日志前附加 keyvals 的 Logger
+func withKeyvals(l Logger, keyvals ...interface{}) Logger {
+	return kvLogger{l: l, keyvals: keyvals}
+}
+
+type kvLogger struct {
+	l       Logger
+	keyvals []interface{}
+}
+
+func (k kvLogger) Debug(msg string, keyvals ...interface{}) { k.l.Debug(msg, k.with(keyvals)...) }
+func (k kvLogger) Info(msg string, keyvals ...interface{})  { k.l.Info(msg, k.with(keyvals)...) }
+func (k kvLogger) Warn(msg string, keyvals ...interface{})  { k.l.Warn(msg, k.with(keyvals)...) }
+func (k kvLogger) Error(msg string, keyvals ...interface{}) { k.l.Error(msg, k.with(keyvals)...) }
+
+func (k kvLogger) with(keyvals []interface{}) []interface{} {
+	return append(append(make([]interface{}, 0, len(k.keyvals)+len(keyvals)), k.keyvals...), keyvals...)
+}
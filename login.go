@@ -0,0 +1,224 @@
+package padchat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ScanState 二维码扫描状态, 由 ScanResp 的 Status 和 SubStatus 得出
+type ScanState int
+
+const (
+	// ScanWaiting 等待扫码
+	ScanWaiting ScanState = iota
+	// ScanScanned 已扫码, 等待在手机上确认
+	ScanScanned
+	// ScanConfirmed 已确认, 登录成功
+	ScanConfirmed
+	// ScanFailed 已确认, 但登录失败
+	ScanFailed
+	// ScanExpired 二维码已过期
+	ScanExpired
+	// ScanCanceled 手机端取消登录
+	ScanCanceled
+	// ScanUnknown 未知状态
+	ScanUnknown
+)
+
+func (s ScanState) String() string {
+	switch s {
+	case ScanWaiting:
+		return "waiting"
+	case ScanScanned:
+		return "scanned"
+	case ScanConfirmed:
+		return "confirmed"
+	case ScanFailed:
+		return "failed"
+	case ScanExpired:
+		return "expired"
+	case ScanCanceled:
+		return "canceled"
+	}
+	return "unknown"
+}
+
+// State 返回扫描状态
+// Status 为 0 未扫码, 1 已扫码, 2 已确认, 3 已过期, 4 已取消, 已确认时 SubStatus 不为 0 表示登录失败
+func (r ScanResp) State() ScanState {
+	switch r.Status {
+	case 0:
+		return ScanWaiting
+	case 1:
+		return ScanScanned
+	case 2:
+		if r.SubStatus != 0 {
+			return ScanFailed
+		}
+		return ScanConfirmed
+	case 3:
+		return ScanExpired
+	case 4:
+		return ScanCanceled
+	}
+	return ScanUnknown
+}
+
+// QRSink 接收二维码登录过程中的二维码和扫码状态
+type QRSink interface {
+	// QRCode 收到二维码, url 为二维码内容, 二维码刷新时会再次调用
+	QRCode(url string)
+	// Scan 扫码状态变化, 状态不变时不会重复调用
+	Scan(scan ScanResp)
+}
+
+// QRFunc 只接收二维码的 QRSink
+type QRFunc func(url string)
+
+// QRCode 实现 QRSink
+func (f QRFunc) QRCode(url string) { f(url) }
+
+// Scan 实现 QRSink
+func (f QRFunc) Scan(ScanResp) {}
+
+// LoginError 登录失败时返回的错误, 可使用 errors.Is 判断 Err 中的哨兵错误,
+// 如 ErrQRExpired, ErrLoginCanceled, ErrPasswordWrong, ErrLoginFailed
+type LoginError struct {
+	// Method 登录方式
+	Method LoginMethod
+	// Msg 服务端返回的错误信息
+	Msg string
+	// Scan 因扫码状态失败时的最后一次扫码状态
+	Scan *ScanResp
+	// Err 失败原因
+	Err error
+}
+
+func (e *LoginError) Error() string {
+	if e.Msg != "" {
+		return fmt.Sprintf("padchat: %s login: %s: %s", e.Method, e.Err, e.Msg)
+	}
+	return fmt.Sprintf("padchat: %s login: %s", e.Method, e.Err)
+}
+
+func (e *LoginError) Unwrap() error {
+	return e.Err
+}
+
+// loginFailure 根据服务端返回的错误信息判断失败原因
+func loginFailure(method LoginMethod, msg string) *LoginError {
+	err := ErrLoginFailed
+	lower := strings.ToLower(msg)
+	if strings.Contains(msg, "密码") || strings.Contains(lower, "password") {
+		err = ErrPasswordWrong
+	}
+	return &LoginError{Method: method, Msg: msg, Err: err}
+}
+
+// LoginWithQR 二维码登录并等待登录结果, 二维码和扫码状态交给 sink, sink 可为 nil.
+// 登录成功返回 GetMyInfo 的结果, 二维码过期, 手机端取消, 收到 warn 或连接关闭时返回 *LoginError
+func (bot *Bot) LoginWithQR(ctx context.Context, sink QRSink) (*MyInfoResp, error) {
+	return bot.waitLogin(ctx, LoginByQRCode, sink, bot.QRLoginCtx)
+}
+
+// LoginWithRequest 二次登陆并等待手机端确认, 参数同 RequestLogin
+func (bot *Bot) LoginWithRequest(ctx context.Context, wxData, token string) (*MyInfoResp, error) {
+	return bot.waitLogin(ctx, LoginByRequest, nil, func(ctx context.Context) (CommandResp, error) {
+		return bot.RequestLoginCtx(ctx, wxData, token)
+	})
+}
+
+// LoginWithToken 断线重连并等待登录结果, 参数同 TokenLogin
+func (bot *Bot) LoginWithToken(ctx context.Context, wxData, token string) (*MyInfoResp, error) {
+	return bot.waitLogin(ctx, LoginByToken, nil, func(ctx context.Context) (CommandResp, error) {
+		return bot.TokenLoginCtx(ctx, wxData, token)
+	})
+}
+
+// LoginWithPassword 账号密码登录并等待登录结果, 参数同 UserLogin, 密码错误时返回 ErrPasswordWrong
+func (bot *Bot) LoginWithPassword(ctx context.Context, wxData, username, password string) (*MyInfoResp, error) {
+	return bot.waitLogin(ctx, LoginByPassword, nil, func(ctx context.Context) (CommandResp, error) {
+		return bot.UserLoginCtx(ctx, wxData, username, password)
+	})
+}
+
+// LoginWithPhone 手机验证码登录并等待登录结果, 参数同 PhoneLogin
+func (bot *Bot) LoginWithPhone(ctx context.Context, wxData, phone, code string) (*MyInfoResp, error) {
+	return bot.waitLogin(ctx, LoginByPhone, nil, func(ctx context.Context) (CommandResp, error) {
+		return bot.PhoneLoginCtx(ctx, wxData, phone, code)
+	})
+}
+
+// waitLogin 发送登录指令前注册临时的 watch, 按接收顺序等待登录成功或失败的事件
+func (bot *Bot) waitLogin(ctx context.Context, method LoginMethod, sink QRSink,
+	login func(ctx context.Context) (CommandResp, error)) (*MyInfoResp, error) {
+	events := make(chan Event, 16)
+	done := make(chan struct{})
+	defer close(done)
+	send := func(e Event) {
+		select {
+		case events <- e:
+		case <-done:
+		}
+	}
+	defer bot.subs.watch.add(func(e Event) {
+		switch e.(type) {
+		case QRURLEvent, ScanEvent, LoginEvent, WarnEvent, DisconnectEvent:
+			send(e)
+		}
+	})()
+
+	if _, err := login(ctx); err != nil {
+		// 服务端拒绝登录时按返回的错误信息判断原因
+		var cerr *Error
+		if errors.As(err, &cerr) && cerr.Err == nil {
+			return nil, loginFailure(method, cerr.Msg)
+		}
+		return nil, err
+	}
+	last := ScanUnknown
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-bot.done:
+			// Shutdown, CloseWS 和服务端 logout 不会产生 DisconnectEvent
+			return nil, &LoginError{Method: method, Err: ErrConnClosed}
+		case e := <-events:
+			switch e := e.(type) {
+			case QRURLEvent:
+				last = ScanUnknown
+				if sink != nil {
+					sink.QRCode(e.URL)
+				}
+			case ScanEvent:
+				state := e.Scan.State()
+				if sink != nil && state != last {
+					sink.Scan(e.Scan)
+				}
+				last = state
+				scan := e.Scan
+				switch state {
+				case ScanFailed:
+					return nil, &LoginError{Method: method, Scan: &scan, Err: ErrLoginFailed}
+				case ScanExpired:
+					return nil, &LoginError{Method: method, Scan: &scan, Err: ErrQRExpired}
+				case ScanCanceled:
+					return nil, &LoginError{Method: method, Scan: &scan, Err: ErrLoginCanceled}
+				}
+			case LoginEvent:
+				return bot.GetMyInfoCtx(ctx)
+			case WarnEvent:
+				return nil, loginFailure(method, e.Warn)
+			case DisconnectEvent:
+				le := &LoginError{Method: method, Err: ErrConnClosed}
+				if e.Err != nil {
+					le.Msg = e.Err.Error()
+				}
+				return nil, le
+			}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package padchat_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuotoo/padchat"
+	"github.com/tuotoo/padchat/padchattest"
+)
+
+type qrRecorder struct {
+	urls   []string
+	states []padchat.ScanState
+}
+
+func (r *qrRecorder) QRCode(url string) { r.urls = append(r.urls, url) }
+
+func (r *qrRecorder) Scan(scan padchat.ScanResp) { r.states = append(r.states, scan.State()) }
+
+func scanEvent(status, subStatus int) padchattest.Event {
+	return padchattest.ScanEvent(padchat.ScanResp{Status: status, SubStatus: subStatus})
+}
+
+func TestScanState(t *testing.T) {
+	for _, c := range []struct {
+		status, sub int
+		want        padchat.ScanState
+	}{
+		{0, 0, padchat.ScanWaiting},
+		{1, 0, padchat.ScanScanned},
+		{2, 0, padchat.ScanConfirmed},
+		{2, 1, padchat.ScanFailed},
+		{3, 0, padchat.ScanExpired},
+		{4, 0, padchat.ScanCanceled},
+		{9, 0, padchat.ScanUnknown},
+	} {
+		assert.Equal(t, c.want, padchat.ScanResp{Status: c.status, SubStatus: c.sub}.State())
+	}
+	assert.Equal(t, "expired", padchat.ScanExpired.String())
+}
+
+func TestLoginWithQR(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("success", func(t *testing.T) {
+		// 默认分发方式下 sink 同样按接收顺序收到二维码和扫码状态
+		bot, s := newTestBot(t)
+		s.Handle("login", func(padchattest.Request) padchattest.Reply {
+			return padchattest.OK(nil,
+				padchattest.QRCodeEvent("qr1"),
+				scanEvent(0, 0), scanEvent(0, 0),
+				scanEvent(1, 0), scanEvent(2, 0),
+				padchattest.LoginEvent())
+		})
+		s.Reply("getMyInfo", padchat.MyInfoResp{UserName: "wxid_me", Uin: 1})
+		sink := &qrRecorder{}
+		info, err := bot.LoginWithQR(ctx, sink)
+		require.NoError(t, err)
+		assert.Equal(t, &padchat.MyInfoResp{UserName: "wxid_me", Uin: 1}, info)
+		assert.Equal(t, []string{"qr1"}, sink.urls)
+		assert.Equal(t, []padchat.ScanState{padchat.ScanWaiting, padchat.ScanScanned, padchat.ScanConfirmed}, sink.states)
+		assert.Equal(t, padchat.StateLoggedIn, bot.State())
+	})
+
+	for _, c := range []struct {
+		name  string
+		event padchattest.Event
+		want  error
+	}{
+		{"expired", scanEvent(3, 0), padchat.ErrQRExpired},
+		{"canceled", scanEvent(4, 0), padchat.ErrLoginCanceled},
+		{"failed", scanEvent(2, 1), padchat.ErrLoginFailed},
+		{"warn", padchattest.WarnEvent("device blocked"), padchat.ErrLoginFailed},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			bot, s := newTestBot(t)
+			s.Handle("login", func(padchattest.Request) padchattest.Reply {
+				return padchattest.OK(nil, padchattest.QRCodeEvent("qr1"), c.event)
+			})
+			sink := &qrRecorder{}
+			_, err := bot.LoginWithQR(ctx, sink)
+			assert.True(t, errors.Is(err, c.want), "%v", err)
+			assert.Equal(t, []string{"qr1"}, sink.urls)
+			var le *padchat.LoginError
+			require.True(t, errors.As(err, &le))
+			assert.Equal(t, padchat.LoginByQRCode, le.Method)
+		})
+	}
+
+	t.Run("shutdown", func(t *testing.T) {
+		bot, s := newTestBot(t)
+		s.Handle("login", func(padchattest.Request) padchattest.Reply {
+			return padchattest.OK(nil, padchattest.QRCodeEvent("qr1"))
+		})
+		errc := make(chan error, 1)
+		go func() {
+			_, err := bot.LoginWithQR(context.Background(), nil)
+			errc <- err
+		}()
+		_, ok := s.WaitRequest("login", time.Second)
+		require.True(t, ok)
+		require.NoError(t, bot.Shutdown(ctx))
+		select {
+		case err := <-errc:
+			assert.True(t, errors.Is(err, padchat.ErrConnClosed), "%v", err)
+		case <-time.After(time.Second):
+			t.Fatal("LoginWithQR not returned after Shutdown")
+		}
+	})
+
+	t.Run("ctx", func(t *testing.T) {
+		bot, s := newTestBot(t)
+		s.Handle("login", func(padchattest.Request) padchattest.Reply {
+			return padchattest.OK(nil, padchattest.QRCodeEvent("qr1"))
+		})
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, err := bot.LoginWithQR(ctx, nil)
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+}
+
+func TestLoginWithPassword(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	bot, s := newTestBot(t)
+	s.Handle("login", func(req padchattest.Request) padchattest.Reply {
+		var data padchat.LoginReq
+		req.Bind(&data)
+		if data.Password != "right" {
+			return padchattest.Fail("账号或密码错误")
+		}
+		return padchattest.OK(nil, padchattest.LoginEvent())
+	})
+	s.Reply("getMyInfo", padchat.MyInfoResp{UserName: "wxid_me"})
+
+	_, err := bot.LoginWithPassword(ctx, "62data", "me", "wrong")
+	assert.True(t, errors.Is(err, padchat.ErrPasswordWrong), "%v", err)
+	info, err := bot.LoginWithPassword(ctx, "62data", "me", "right")
+	require.NoError(t, err)
+	assert.Equal(t, "wxid_me", info.UserName)
+}
@@ -0,0 +1,377 @@
+package padchat
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ManagerOption 创建 Manager 时的配置项
+type ManagerOption func(*Manager)
+
+// WithBotOptions 设置所有账号共用的 BotOption, 在账号自身的配置项之前应用
+func WithBotOptions(opts ...BotOption) ManagerOption {
+	return func(m *Manager) {
+		m.botOpts = append(m.botOpts, opts...)
+	}
+}
+
+// WithManagerLogger 设置 Manager 及所有账号的日志输出, 账号的日志会附带 account 字段
+func WithManagerLogger(l Logger) ManagerOption {
+	return func(m *Manager) {
+		m.logger = l
+	}
+}
+
+// WithSessions 设置每个账号的登录凭据存储, 添加账号时会使用返回的 SessionStore 自动登录
+func WithSessions(f func(accountID string) SessionStore) ManagerOption {
+	return func(m *Manager) {
+		m.sessions = f
+	}
+}
+
+// SessionDir 返回将每个账号的登录凭据保存为 dir 下 `账号ID.json` 文件的函数, 用于 WithSessions
+func SessionDir(dir string) func(accountID string) SessionStore {
+	return func(accountID string) SessionStore {
+		return NewFileSessionStore(filepath.Join(dir, accountID+".json"))
+	}
+}
+
+// Account 账号配置
+type Account struct {
+	// ID 账号 ID, 由调用方指定, 在 Manager 中唯一
+	ID string
+	// URL PadChat 服务端地址
+	URL string
+	// Options 账号自身的配置项
+	Options []BotOption
+}
+
+// AccountEvent 带有账号 ID 的事件
+type AccountEvent struct {
+	AccountID string
+	Event     Event
+}
+
+// AccountStatus 账号状态
+type AccountStatus struct {
+	ID    string
+	State State
+	// AddedAt 添加账号的时间
+	AddedAt time.Time
+	// LoginAt 最近一次登录成功的时间, 未登录过时为零值
+	LoginAt time.Time
+	// LoginMethod 自动登录使用的方式, 未设置 WithSessions 时为空
+	LoginMethod LoginMethod
+	// LoginErr 自动登录失败的原因
+	LoginErr error
+	Commands CommandStats
+}
+
+// Manager 管理多个微信账号, 每个账号对应一个 Bot,
+// 所有账号的事件附带账号 ID 后统一分发, 可在运行时添加和移除账号
+type Manager struct {
+	mu       sync.RWMutex
+	accounts map[string]*account
+	botOpts  []BotOption
+	sessions func(accountID string) SessionStore
+	logger   Logger
+	handlers handlerList[func(AccountEvent)]
+	forwards sync.WaitGroup
+
+	eventChMu     sync.RWMutex
+	eventCh       chan AccountEvent
+	eventChClosed bool
+	done          chan struct{}
+	closeOnce     sync.Once
+}
+
+type account struct {
+	mu     sync.Mutex
+	bot    *Bot
+	status AccountStatus
+}
+
+// NewManager 新建 Manager, 账号默认开启 DefaultReconnectPolicy 断线重连
+func NewManager(opts ...ManagerOption) *Manager {
+	policy := DefaultReconnectPolicy
+	m := &Manager{
+		accounts: make(map[string]*account),
+		botOpts:  []BotOption{WithReconnect(&policy)},
+		logger:   NopLogger,
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Add 添加账号并连接服务端, 设置了 WithSessions 时会自动登录,
+// 自动登录失败不会返回错误, 可通过 Status 查看
+func (m *Manager) Add(ctx context.Context, a Account) (*Bot, error) {
+	acc := &account{status: AccountStatus{ID: a.ID, AddedAt: time.Now()}}
+	m.mu.Lock()
+	if m.isClosed() {
+		m.mu.Unlock()
+		return nil, ErrConnClosed
+	}
+	if _, ok := m.accounts[a.ID]; ok {
+		m.mu.Unlock()
+		return nil, ErrAccountExists
+	}
+	// 先占用 ID, 避免并发添加相同账号
+	m.accounts[a.ID] = acc
+	m.mu.Unlock()
+
+	logger := withKeyvals(m.logger, "account", a.ID)
+	opts := append([]BotOption{WithLogger(logger)}, m.botOpts...)
+	bot, err := NewBot(a.URL, append(opts, a.Options...)...)
+	if err != nil {
+		m.mu.Lock()
+		delete(m.accounts, a.ID)
+		m.mu.Unlock()
+		return nil, err
+	}
+	acc.mu.Lock()
+	acc.bot = bot
+	acc.mu.Unlock()
+	// 在锁内检查并登记转发协程, 避免与 Shutdown 中的 forwards.Wait 并发
+	m.mu.Lock()
+	removed := m.accounts[a.ID] != acc
+	closed := m.isClosed()
+	if closed && !removed {
+		delete(m.accounts, a.ID)
+	}
+	if !removed && !closed {
+		m.forwards.Add(1)
+	}
+	m.mu.Unlock()
+	if removed || closed {
+		// 连接期间账号已被移除或 Manager 已关闭
+		bot.Shutdown(ctx)
+		if closed {
+			return nil, ErrConnClosed
+		}
+		return nil, ErrAccountNotFound
+	}
+	go m.forward(a.ID, acc, bot.Events())
+	logger.Info("account added")
+
+	if m.sessions != nil {
+		method, err := bot.AutoLoginCtx(ctx, m.sessions(a.ID))
+		if err != nil {
+			logger.Warn("auto login failed", "error", err)
+		}
+		acc.mu.Lock()
+		acc.status.LoginMethod = method
+		acc.status.LoginErr = err
+		acc.mu.Unlock()
+	}
+	return bot, nil
+}
+
+// forward 将账号的事件附带账号 ID 后分发, Bot 关闭后退出
+func (m *Manager) forward(id string, acc *account, events <-chan Event) {
+	defer m.forwards.Done()
+	for e := range events {
+		if _, ok := e.(LoginEvent); ok {
+			acc.mu.Lock()
+			acc.status.LoginAt = time.Now()
+			acc.mu.Unlock()
+		}
+		ae := AccountEvent{AccountID: id, Event: e}
+		m.handlers.each(func(f func(AccountEvent)) { f(ae) }, func(v interface{}, stack []byte) {
+			// 处理 HandlerPanicEvent 时的 panic 只记录日志, 避免循环.
+			// 其他 panic 交给账号的 OnHandlerPanic, 异步执行避免阻塞在本协程读取的 Events 上
+			if _, ok := ae.Event.(HandlerPanicEvent); ok {
+				m.logger.Error("handler panic", "account", id, "panic", v, "stack", string(stack))
+				return
+			}
+			if bot := acc.getBot(); bot != nil {
+				go bot.handlerPanic(ae.Event, v, stack)
+			}
+		})
+		m.publish(ae)
+	}
+}
+
+// Remove 移除账号并关闭其 Bot, 等待回调执行完毕或 ctx 结束
+func (m *Manager) Remove(ctx context.Context, id string) error {
+	m.mu.Lock()
+	acc, ok := m.accounts[id]
+	if ok {
+		delete(m.accounts, id)
+	}
+	m.mu.Unlock()
+	if !ok {
+		return ErrAccountNotFound
+	}
+	bot := acc.getBot()
+	if bot == nil {
+		return nil
+	}
+	m.logger.Info("account removed", "account", id)
+	return bot.Shutdown(ctx)
+}
+
+// Get 返回账号的 Bot
+func (m *Manager) Get(id string) (*Bot, bool) {
+	m.mu.RLock()
+	acc, ok := m.accounts[id]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	bot := acc.getBot()
+	return bot, bot != nil
+}
+
+// IDs 返回所有账号 ID, 按 ID 排序
+func (m *Manager) IDs() []string {
+	m.mu.RLock()
+	ids := make([]string, 0, len(m.accounts))
+	for id := range m.accounts {
+		ids = append(ids, id)
+	}
+	m.mu.RUnlock()
+	sort.Strings(ids)
+	return ids
+}
+
+// Status 返回账号状态
+func (m *Manager) Status(id string) (AccountStatus, bool) {
+	m.mu.RLock()
+	acc, ok := m.accounts[id]
+	m.mu.RUnlock()
+	if !ok {
+		return AccountStatus{}, false
+	}
+	return acc.getStatus(), true
+}
+
+// Statuses 返回所有账号的状态, 按 ID 排序
+func (m *Manager) Statuses() []AccountStatus {
+	var list []AccountStatus
+	for _, id := range m.IDs() {
+		if s, ok := m.Status(id); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// OnEvent 所有账号的事件回调, 在账号的事件转发协程中同步执行, 不应阻塞,
+// 回调中的 panic 交给对应账号的 OnHandlerPanic
+func (m *Manager) OnEvent(f func(e AccountEvent)) (unsubscribe func()) {
+	return m.handlers.add(f)
+}
+
+// Events 返回接收所有账号事件的 channel, 多次调用返回同一个 channel, Shutdown 完成后关闭
+func (m *Manager) Events() <-chan AccountEvent {
+	m.eventChMu.RLock()
+	ch := m.eventCh
+	m.eventChMu.RUnlock()
+	if ch != nil {
+		return ch
+	}
+	m.eventChMu.Lock()
+	defer m.eventChMu.Unlock()
+	if m.eventCh == nil {
+		m.eventCh = make(chan AccountEvent, defaultEventQueueSize)
+		if m.eventChClosed {
+			close(m.eventCh)
+		}
+	}
+	return m.eventCh
+}
+
+// publish 将事件写入 Events 返回的 channel, 写入时不持有 eventChMu.
+// 只在 forward 中调用, Shutdown 等待所有 forward 退出后才关闭 channel
+func (m *Manager) publish(e AccountEvent) {
+	m.eventChMu.RLock()
+	ch, closed := m.eventCh, m.eventChClosed
+	m.eventChMu.RUnlock()
+	if ch == nil || closed {
+		return
+	}
+	select {
+	case ch <- e:
+	case <-m.done:
+	}
+}
+
+// Shutdown 关闭所有账号, 之后无法再添加账号
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.closeOnce.Do(func() {
+		m.mu.Lock()
+		close(m.done)
+		m.mu.Unlock()
+	})
+	ids := m.IDs()
+	var wg sync.WaitGroup
+	errs := make(chan error, len(ids))
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			if err := m.Remove(ctx, id); err != nil && err != ErrAccountNotFound {
+				errs <- err
+			}
+		}(id)
+	}
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+	stopped := make(chan struct{})
+	go func() {
+		m.forwards.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	m.eventChMu.Lock()
+	defer m.eventChMu.Unlock()
+	if !m.eventChClosed {
+		m.eventChClosed = true
+		if m.eventCh != nil {
+			close(m.eventCh)
+		}
+	}
+	return nil
+}
+
+func (m *Manager) isClosed() bool {
+	select {
+	case <-m.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (a *account) getBot() *Bot {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.bot
+}
+
+func (a *account) getStatus() AccountStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s := a.status
+	if a.bot != nil {
+		s.State = a.bot.State()
+		s.Commands = a.bot.CommandStats()
+	} else {
+		s.State = StateConnecting
+	}
+	return s
+}
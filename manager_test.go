@@ -0,0 +1,149 @@
+package padchat_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuotoo/padchat"
+	"github.com/tuotoo/padchat/padchattest"
+)
+
+func TestManager(t *testing.T) {
+	sessions := map[string]*padchat.MemorySessionStore{}
+	m := padchat.NewManager(padchat.WithSessions(func(id string) padchat.SessionStore {
+		sessions[id] = padchat.NewMemorySessionStore()
+		return sessions[id]
+	}))
+	events := m.Events()
+	logins := make(chan string, 2)
+	m.OnEvent(func(e padchat.AccountEvent) {
+		if _, ok := e.Event.(padchat.LoginEvent); ok {
+			logins <- e.AccountID
+		}
+	})
+
+	ctx := context.Background()
+	for _, id := range []string{"b", "a"} {
+		s := padchattest.NewServer()
+		defer s.Close()
+		_, err := m.Add(ctx, padchat.Account{ID: id, URL: s.URL})
+		require.NoError(t, err)
+	}
+	_, err := m.Add(ctx, padchat.Account{ID: "a", URL: "ws://127.0.0.1:1"})
+	assert.True(t, errors.Is(err, padchat.ErrAccountExists))
+	assert.Equal(t, []string{"a", "b"}, m.IDs())
+
+	got := []string{<-logins, <-logins}
+	assert.ElementsMatch(t, []string{"a", "b"}, got)
+	status, ok := m.Status("a")
+	require.True(t, ok)
+	assert.Equal(t, padchat.LoginByQRCode, status.LoginMethod)
+	assert.NoError(t, status.LoginErr)
+	assert.False(t, status.LoginAt.IsZero())
+	assert.Equal(t, padchat.StateLoggedIn, status.State)
+
+	bot, ok := m.Get("a")
+	require.True(t, ok)
+	assert.True(t, bot.SyncMsg().Success)
+
+	require.NoError(t, m.Remove(ctx, "a"))
+	assert.Equal(t, []string{"b"}, m.IDs())
+	assert.True(t, errors.Is(m.Remove(ctx, "a"), padchat.ErrAccountNotFound))
+	assert.Equal(t, padchat.StateDisconnected, bot.State())
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	require.NoError(t, m.Shutdown(ctx))
+	assert.Empty(t, m.Statuses())
+	accounts := map[string]bool{}
+	for e := range events {
+		accounts[e.AccountID] = true
+	}
+	assert.Equal(t, map[string]bool{"a": true, "b": true}, accounts)
+	_, err = m.Add(ctx, padchat.Account{ID: "c"})
+	assert.True(t, errors.Is(err, padchat.ErrConnClosed))
+}
+
+func TestManagerEventsFull(t *testing.T) {
+	m := padchat.NewManager()
+	defer m.Shutdown(context.Background())
+	s := padchattest.NewServer()
+	defer s.Close()
+	_, err := m.Add(context.Background(), padchat.Account{ID: "a", URL: s.URL})
+	require.NoError(t, err)
+	m.Events()
+	const n = 300
+	events := make([]padchattest.Event, n)
+	for i := range events {
+		events[i] = padchattest.LoadedEvent()
+	}
+	require.NoError(t, s.Emit(events...))
+	// 等待 channel 写满, 之后每次读取都重新调用 Events
+	time.Sleep(100 * time.Millisecond)
+	timeout := time.After(5 * time.Second)
+	for loaded := 0; loaded < n; {
+		select {
+		case e := <-m.Events():
+			if _, ok := e.Event.(padchat.LoadedEvent); ok {
+				loaded++
+			}
+		case <-timeout:
+			t.Fatalf("got %d loaded events, want %d", loaded, n)
+		}
+	}
+}
+
+func TestManagerEventPanic(t *testing.T) {
+	m := padchat.NewManager()
+	defer m.Shutdown(context.Background())
+	s := padchattest.NewServer()
+	defer s.Close()
+	bot, err := m.Add(context.Background(), padchat.Account{ID: "a", URL: s.URL})
+	require.NoError(t, err)
+	panics := make(chan padchat.HandlerPanicEvent, 10)
+	bot.OnHandlerPanic(func(e padchat.HandlerPanicEvent) { panics <- e })
+	// 处理 HandlerPanicEvent 时同样 panic, 不应循环
+	m.OnEvent(func(padchat.AccountEvent) { panic("boom") })
+
+	require.NoError(t, s.Emit(padchattest.LoadedEvent()))
+	select {
+	case e := <-panics:
+		assert.Equal(t, "boom", e.Value)
+		assert.IsType(t, padchat.LoadedEvent{}, e.Event)
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler panic not reported")
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, panics, 0)
+}
+
+func TestManagerAddShutdown(t *testing.T) {
+	s := padchattest.NewServer()
+	defer s.Close()
+	for i := 0; i < 10; i++ {
+		m := padchat.NewManager()
+		var wg sync.WaitGroup
+		for j := 0; j < 3; j++ {
+			wg.Add(1)
+			go func(id string) {
+				defer wg.Done()
+				bot, err := m.Add(context.Background(), padchat.Account{ID: id, URL: s.URL})
+				if err != nil {
+					assert.Nil(t, bot)
+				}
+			}(strconv.Itoa(j))
+		}
+		require.NoError(t, m.Shutdown(context.Background()))
+		wg.Wait()
+		// Shutdown 之后添加的账号不会保留
+		_, err := m.Add(context.Background(), padchat.Account{ID: "late", URL: s.URL})
+		assert.Equal(t, padchat.ErrConnClosed, err)
+	}
+}
@@ -0,0 +1,69 @@
+package padchat
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// Logging 记录每条消息的处理耗时
+func Logging(logger Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *MsgContext) {
+			start := time.Now()
+			next(c)
+			logger.Info("msg handled",
+				"msg_id", c.Msg.MsgID,
+				"type", c.Msg.MType,
+				"from", c.Msg.SenderID(),
+				"group", c.Msg.GroupID(),
+				"elapsed", time.Since(start))
+		}
+	}
+}
+
+// Recover 捕获处理函数中的 panic 并记录堆栈, 避免影响其他消息
+func Recover(logger Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *MsgContext) {
+			defer func() {
+				if v := recover(); v != nil {
+					logger.Error("msg handler panic",
+						"msg_id", c.Msg.MsgID,
+						"panic", fmt.Sprint(v),
+						"stack", string(debug.Stack()))
+				}
+			}()
+			next(c)
+		}
+	}
+}
+
+// RateLimit 限制每个发送者的消息处理频率, 每 interval 补充一次, 最多连续处理 burst 条,
+// 超出限制的消息被丢弃, 如果设置了 onLimit 则交给 onLimit 处理
+func RateLimit(interval time.Duration, burst int, onLimit HandlerFunc) Middleware {
+	limiter := newRateLimiter(interval, burst)
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *MsgContext) {
+			if limiter.allow(c.Msg.SenderID(), time.Now()) {
+				next(c)
+			} else if onLimit != nil {
+				onLimit(c)
+			}
+		}
+	}
+}
+
+// Auth 只处理满足 allow 条件的消息, 如 Auth(FromSender("wxid_admin")),
+// 其他消息被丢弃, 如果设置了 onDeny 则交给 onDeny 处理
+func Auth(allow Matcher, onDeny HandlerFunc) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *MsgContext) {
+			if allow(c) {
+				next(c)
+			} else if onDeny != nil {
+				onDeny(c)
+			}
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package padchat
+
+import (
+	"encoding/xml"
+	"strings"
+
+	"github.com/json-iterator/go"
+)
+
+// 消息类型, 对应 Msg.MType
+const (
+	MsgTypeText          = 1
+	MsgTypeImage         = 3
+	MsgTypeVoice         = 34
+	MsgTypeFriendRequest = 37
+	MsgTypeCard          = 42
+	MsgTypeVideo         = 43
+	MsgTypeEmoji         = 47
+	MsgTypeLocation      = 48
+	MsgTypeApp           = 49
+	MsgTypeStatusNotify  = 51
+	MsgTypeShortVideo    = 62
+	MsgTypeSystem        = 10000
+	MsgTypeRecall        = 10002
+)
+
+// MsgTypeApp 消息的子类型, 对应 appmsg 中的 type 字段
+const (
+	AppMsgTypeLink      = 5
+	AppMsgTypeFile      = 6
+	AppMsgTypeTransfer  = 2000
+	AppMsgTypeRedPacket = 2001
+)
+
+// Message ParseMsg 解析后的消息, 可通过 type switch 获取具体类型
+type Message interface {
+	// Raw 返回原始消息
+	Raw() Msg
+}
+
+// Raw 返回消息本身
+func (m Msg) Raw() Msg {
+	return m
+}
+
+// contentString 返回 Content 中的文本
+func (m Msg) contentString() string {
+	var s string
+	if err := jsoniter.Unmarshal(m.Content, &s); err != nil {
+		return string(m.Content)
+	}
+	return s
+}
+
+// TextMsg 文本消息
+type TextMsg struct {
+	Msg  `xml:"-"`
+	Text string
+}
+
+// ImageMsg 图片消息, 原图需通过 GetMsgImage 获取
+type ImageMsg struct {
+	Msg    `xml:"-"`
+	AesKey string `xml:"aeskey,attr"`
+	Length int    `xml:"length,attr"`
+	MD5    string `xml:"md5,attr"`
+}
+
+// VoiceMsg 语音消息, 语音数据需通过 GetMsgVoice 获取
+type VoiceMsg struct {
+	Msg    `xml:"-"`
+	Length int `xml:"length,attr"`
+	// Duration 语音时长, 单位毫秒
+	Duration int `xml:"voicelength,attr"`
+}
+
+// VideoMsg 视频消息, 视频数据需通过 GetMsgVideo 获取
+type VideoMsg struct {
+	Msg    `xml:"-"`
+	Length int `xml:"length,attr"`
+	// PlayLength 视频时长, 单位秒
+	PlayLength int `xml:"playlength,attr"`
+}
+
+// EmojiMsg 表情消息
+type EmojiMsg struct {
+	Msg    `xml:"-"`
+	MD5    string `xml:"md5,attr"`
+	CdnURL string `xml:"cdnurl,attr"`
+	Width  int    `xml:"width,attr"`
+	Height int    `xml:"height,attr"`
+}
+
+// LocationMsg 位置消息
+type LocationMsg struct {
+	Msg     `xml:"-"`
+	X       float64 `xml:"x,attr"`
+	Y       float64 `xml:"y,attr"`
+	Scale   int     `xml:"scale,attr"`
+	Label   string  `xml:"label,attr"`
+	PoiName string  `xml:"poiname,attr"`
+}
+
+// CardMsg 名片消息
+type CardMsg struct {
+	Msg        `xml:"-"`
+	UserName   string `xml:"username,attr"`
+	NickName   string `xml:"nickname,attr"`
+	Alias      string `xml:"alias,attr"`
+	Province   string `xml:"province,attr"`
+	City       string `xml:"city,attr"`
+	Sex        int    `xml:"sex,attr"`
+	BigHeadURL string `xml:"bigheadimgurl,attr"`
+}
+
+// LinkMsg 链接及其他应用消息
+type LinkMsg struct {
+	Msg     `xml:"-"`
+	AppType int    `xml:"appmsg>type"`
+	Title   string `xml:"appmsg>title"`
+	Desc    string `xml:"appmsg>des"`
+	URL     string `xml:"appmsg>url"`
+}
+
+// FileMsg 文件消息
+type FileMsg struct {
+	Msg      `xml:"-"`
+	Title    string `xml:"appmsg>title"`
+	FileExt  string `xml:"appmsg>appattach>fileext"`
+	TotalLen int64  `xml:"appmsg>appattach>totallen"`
+	AttachID string `xml:"appmsg>appattach>attachid"`
+}
+
+// RedPacketMsg 红包消息, 可通过 ReceiveRedPacket 和 OpenRedPacket 领取
+type RedPacketMsg struct {
+	Msg           `xml:"-"`
+	Title         string `xml:"appmsg>title"`
+	SenderTitle   string `xml:"appmsg>wcpayinfo>sendertitle"`
+	ReceiverTitle string `xml:"appmsg>wcpayinfo>receivertitle"`
+	NativeURL     string `xml:"appmsg>wcpayinfo>nativeurl"`
+	SceneID       int    `xml:"appmsg>wcpayinfo>sceneid"`
+	SceneText     string `xml:"appmsg>wcpayinfo>scenetext"`
+	InvalidTime   int64  `xml:"appmsg>wcpayinfo>invalidtime"`
+}
+
+// TransferMsg 转账消息, 可通过 QueryTransfer 和 AcceptTransfer 接收
+type TransferMsg struct {
+	Msg           `xml:"-"`
+	Title         string `xml:"appmsg>title"`
+	FeeDesc       string `xml:"appmsg>wcpayinfo>feedesc"`
+	PaySubType    int    `xml:"appmsg>wcpayinfo>paysubtype"`
+	TransferID    string `xml:"appmsg>wcpayinfo>transferid"`
+	TransactionID string `xml:"appmsg>wcpayinfo>transcationid"`
+	InvalidTime   int64  `xml:"appmsg>wcpayinfo>invalidtime"`
+	PayMemo       string `xml:"appmsg>wcpayinfo>pay_memo"`
+}
+
+// SystemNoticeMsg 系统通知, 如群成员变动, 红包领取提示等
+type SystemNoticeMsg struct {
+	Msg  `xml:"-"`
+	Text string
+}
+
+// RecallMsg 撤回消息通知
+type RecallMsg struct {
+	Msg     `xml:"-"`
+	Type    string `xml:"type,attr"`
+	Session string `xml:"revokemsg>session"`
+	// RecalledMsgID 被撤回的消息 ID
+	RecalledMsgID string `xml:"revokemsg>newmsgid"`
+	ReplaceMsg    string `xml:"revokemsg>replacemsg"`
+}
+
+// FriendRequestMsg 好友请求, 可使用 Stranger 和 Ticket 调用 AcceptUser 通过验证
+type FriendRequestMsg struct {
+	Msg          `xml:"-"`
+	FromUserName string `xml:"fromusername,attr"`
+	FromNickName string `xml:"fromnickname,attr"`
+	Stranger     string `xml:"encryptusername,attr"`
+	Ticket       string `xml:"ticket,attr"`
+	Text         string `xml:"content,attr"`
+	Scene        int    `xml:"scene,attr"`
+	BigHeadURL   string `xml:"bigheadimgurl,attr"`
+}
+
+// UnknownMsg 无法识别类型的消息
+type UnknownMsg struct {
+	Msg `xml:"-"`
+}
+
+// ParseMsg 根据消息类型解析 Content 中的数据, 返回 TextMsg, ImageMsg 等具体类型,
+// 群消息的发送者前缀会被去除, 无法识别的类型返回 UnknownMsg, 解析失败时返回 error
+func ParseMsg(msg Msg) (Message, error) {
+	content := msg.Body()
+	switch msg.MType {
+	case MsgTypeText:
+		return TextMsg{Msg: msg, Text: content}, nil
+	case MsgTypeImage:
+		m := ImageMsg{Msg: msg}
+		err := unmarshalXML(content, &struct {
+			V *ImageMsg `xml:"img"`
+		}{&m})
+		return m, err
+	case MsgTypeVoice:
+		m := VoiceMsg{Msg: msg}
+		err := unmarshalXML(content, &struct {
+			V *VoiceMsg `xml:"voicemsg"`
+		}{&m})
+		return m, err
+	case MsgTypeVideo, MsgTypeShortVideo:
+		m := VideoMsg{Msg: msg}
+		err := unmarshalXML(content, &struct {
+			V *VideoMsg `xml:"videomsg"`
+		}{&m})
+		return m, err
+	case MsgTypeEmoji:
+		m := EmojiMsg{Msg: msg}
+		err := unmarshalXML(content, &struct {
+			V *EmojiMsg `xml:"emoji"`
+		}{&m})
+		return m, err
+	case MsgTypeLocation:
+		m := LocationMsg{Msg: msg}
+		err := unmarshalXML(content, &struct {
+			V *LocationMsg `xml:"location"`
+		}{&m})
+		return m, err
+	case MsgTypeCard:
+		m := CardMsg{Msg: msg}
+		err := unmarshalXML(content, &m)
+		return m, err
+	case MsgTypeFriendRequest:
+		m := FriendRequestMsg{Msg: msg}
+		err := unmarshalXML(content, &m)
+		return m, err
+	case MsgTypeSystem:
+		return SystemNoticeMsg{Msg: msg, Text: content}, nil
+	case MsgTypeRecall:
+		m := RecallMsg{Msg: msg}
+		if err := unmarshalXML(content, &m); err != nil || m.Type != "revokemsg" {
+			return SystemNoticeMsg{Msg: msg, Text: content}, err
+		}
+		return m, nil
+	case MsgTypeApp:
+		return parseAppMsg(msg, content)
+	}
+	return UnknownMsg{Msg: msg}, nil
+}
+
+func parseAppMsg(msg Msg, content string) (Message, error) {
+	link := LinkMsg{Msg: msg}
+	if err := unmarshalXML(content, &link); err != nil {
+		return link, err
+	}
+	switch link.AppType {
+	case AppMsgTypeFile:
+		m := FileMsg{Msg: msg}
+		err := unmarshalXML(content, &m)
+		return m, err
+	case AppMsgTypeTransfer:
+		m := TransferMsg{Msg: msg}
+		err := unmarshalXML(content, &m)
+		return m, err
+	case AppMsgTypeRedPacket:
+		m := RedPacketMsg{Msg: msg}
+		err := unmarshalXML(content, &m)
+		return m, err
+	}
+	return link, nil
+}
+
+// unmarshalXML 解析消息中的 XML 数据, 跳过群消息中 XML 之前的发送者前缀
+func unmarshalXML(content string, v interface{}) error {
+	if i := strings.Index(content, "<"); i > 0 {
+		content = content[i:]
+	}
+	return xml.Unmarshal([]byte(content), v)
+}
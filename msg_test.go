@@ -0,0 +1,83 @@
+package padchat_test
+
+import (
+	"testing"
+
+	"github.com/json-iterator/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuotoo/padchat"
+)
+
+func newMsg(mType int, content string) padchat.Msg {
+	b, _ := jsoniter.Marshal(content)
+	return padchat.Msg{MType: mType, SubType: mType, FromUser: "wxid_a", Content: b}
+}
+
+func TestParseMsg(t *testing.T) {
+	m, err := padchat.ParseMsg(newMsg(padchat.MsgTypeText, "hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", m.(padchat.TextMsg).Text)
+	assert.Equal(t, "wxid_a", m.Raw().FromUser)
+
+	m, err = padchat.ParseMsg(newMsg(padchat.MsgTypeImage,
+		`<?xml version="1.0"?><msg><img aeskey="k" length="1024" md5="m" /></msg>`))
+	require.NoError(t, err)
+	assert.Equal(t, padchat.ImageMsg{Msg: m.Raw(), AesKey: "k", Length: 1024, MD5: "m"}, m)
+
+	m, err = padchat.ParseMsg(newMsg(padchat.MsgTypeLocation,
+		`<msg><location x="39.9" y="116.3" scale="16" label="北京" poiname="天安门" /></msg>`))
+	require.NoError(t, err)
+	loc := m.(padchat.LocationMsg)
+	assert.Equal(t, 39.9, loc.X)
+	assert.Equal(t, "天安门", loc.PoiName)
+
+	m, err = padchat.ParseMsg(newMsg(padchat.MsgTypeApp,
+		`<msg><appmsg><title><![CDATA[微信红包]]></title><type>2001</type>`+
+			`<wcpayinfo><sendertitle><![CDATA[恭喜发财]]></sendertitle></wcpayinfo></appmsg></msg>`))
+	require.NoError(t, err)
+	assert.Equal(t, "恭喜发财", m.(padchat.RedPacketMsg).SenderTitle)
+
+	m, err = padchat.ParseMsg(newMsg(padchat.MsgTypeApp,
+		`<msg><appmsg><title><![CDATA[微信转账]]></title><type>2000</type>`+
+			`<wcpayinfo><paysubtype>1</paysubtype><feedesc><![CDATA[￥0.01]]></feedesc></wcpayinfo></appmsg></msg>`))
+	require.NoError(t, err)
+	assert.Equal(t, "￥0.01", m.(padchat.TransferMsg).FeeDesc)
+
+	m, err = padchat.ParseMsg(newMsg(padchat.MsgTypeApp,
+		`<msg><appmsg><title>a.pdf</title><type>6</type><appattach><totallen>10</totallen>`+
+			`<fileext>pdf</fileext></appattach></appmsg></msg>`))
+	require.NoError(t, err)
+	assert.Equal(t, "pdf", m.(padchat.FileMsg).FileExt)
+
+	m, err = padchat.ParseMsg(newMsg(padchat.MsgTypeApp,
+		`<msg><appmsg><title>t</title><type>5</type><url>http://a</url></appmsg></msg>`))
+	require.NoError(t, err)
+	assert.Equal(t, "http://a", m.(padchat.LinkMsg).URL)
+
+	m, err = padchat.ParseMsg(newMsg(padchat.MsgTypeRecall,
+		`room@chatroom:
+<sysmsg type="revokemsg"><revokemsg><session>room@chatroom</session>`+
+			`<newmsgid>123</newmsgid><replacemsg><![CDATA["a" 撤回了一条消息]]></replacemsg></revokemsg></sysmsg>`))
+	require.NoError(t, err)
+	assert.Equal(t, "123", m.(padchat.RecallMsg).RecalledMsgID)
+
+	m, err = padchat.ParseMsg(newMsg(padchat.MsgTypeFriendRequest,
+		`<msg fromusername="wxid_b" encryptusername="v1_x" fromnickname="b" content="hi" scene="30" ticket="v2_x" />`))
+	require.NoError(t, err)
+	req := m.(padchat.FriendRequestMsg)
+	assert.Equal(t, "v1_x", req.Stranger)
+	assert.Equal(t, "v2_x", req.Ticket)
+
+	m, err = padchat.ParseMsg(newMsg(padchat.MsgTypeSystem, "a 邀请 b 加入了群聊"))
+	require.NoError(t, err)
+	assert.Equal(t, "a 邀请 b 加入了群聊", m.(padchat.SystemNoticeMsg).Text)
+
+	m, err = padchat.ParseMsg(newMsg(9999, ""))
+	require.NoError(t, err)
+	assert.IsType(t, padchat.UnknownMsg{}, m)
+
+	_, err = padchat.ParseMsg(newMsg(padchat.MsgTypeImage, "<msg"))
+	assert.Error(t, err)
+}
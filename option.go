@@ -0,0 +1,109 @@
+package padchat
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// BotOption 创建 Bot 时的配置项
+type BotOption func(*Bot)
+
+// WithLogger 设置日志输出, 默认为 NopLogger
+func WithLogger(l Logger) BotOption {
+	return func(bot *Bot) {
+		bot.logger = l
+	}
+}
+
+// WithDialer 设置建立 ws 连接使用的 Dialer, 可用于配置代理和握手超时等, 为 nil 时使用默认的 Dialer
+func WithDialer(d *websocket.Dialer) BotOption {
+	return func(bot *Bot) {
+		if d != nil {
+			bot.dialer = d
+		}
+	}
+}
+
+// WithHeader 设置建立 ws 连接时的请求头, 可用于传递认证信息
+func WithHeader(h http.Header) BotOption {
+	return func(bot *Bot) {
+		bot.header = h
+	}
+}
+
+// WithTLSConfig 设置连接 wss:// 地址时使用的 TLS 配置
+func WithTLSConfig(c *tls.Config) BotOption {
+	return func(bot *Bot) {
+		bot.tlsConfig = c
+	}
+}
+
+// WithCompression 开启 ws 消息压缩, 需服务端支持
+func WithCompression() BotOption {
+	return func(bot *Bot) {
+		bot.compression = true
+	}
+}
+
+// WithCommandTimeout 设置微信指令超时时间, 默认为 30 秒
+func WithCommandTimeout(t time.Duration) BotOption {
+	return func(bot *Bot) {
+		bot.reqTimeout = t
+	}
+}
+
+// WithReadLimit 设置单条 ws 消息的最大字节数, 默认不限制
+func WithReadLimit(n int64) BotOption {
+	return func(bot *Bot) {
+		bot.readLimit = n
+	}
+}
+
+// WithPingInterval 设置发送 ping 的间隔, 默认不发送
+// 开启后超过 WithPongTimeout 设置的时间未收到任何数据时视为连接断开
+func WithPingInterval(t time.Duration) BotOption {
+	return func(bot *Bot) {
+		bot.pingInterval = t
+	}
+}
+
+// WithPongTimeout 设置等待 pong 的超时时间, 默认为 ping 间隔的两倍
+func WithPongTimeout(t time.Duration) BotOption {
+	return func(bot *Bot) {
+		bot.pongTimeout = t
+	}
+}
+
+// WithReconnect 设置断线重连策略, 同 SetReconnect
+func WithReconnect(p *ReconnectPolicy) BotOption {
+	return func(bot *Bot) {
+		bot.reconnect = p
+	}
+}
+
+// WithOrderedDelivery 开启有序分发: 同一会话 (群或好友) 的事件按接收顺序依次执行回调,
+// 不同会话由多个 worker 并发处理. 默认由 4 个 worker 从共用的队列中取出事件执行回调, 不保证顺序
+func WithOrderedDelivery(cfg DeliveryConfig) BotOption {
+	return func(bot *Bot) {
+		if f := cfg.OnOverflow; f != nil {
+			cfg.OnOverflow = func(e Event, err error) {
+				bot.guard(e, func() { f(e, err) })
+			}
+		}
+		bot.delivery = newEventDelivery(cfg, true)
+	}
+}
+
+// WithDedup 开启消息去重, 断线重连或 SyncMsg 后服务端重复推送的消息不会再次触发 OnMsg,
+// store 可使用 NewMemoryDedupStore 或 NewFileDedupStore, 为 nil 时使用默认大小的 MemoryDedupStore
+func WithDedup(store DedupStore) BotOption {
+	return func(bot *Bot) {
+		if store == nil {
+			store = NewMemoryDedupStore(0, 0)
+		}
+		bot.dedup = store
+	}
+}
@@ -0,0 +1,495 @@
+package padchat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OutMsgType Outbox 中消息的类型
+type OutMsgType string
+
+const (
+	// OutMsgText 文字消息, 使用 SendMsg 发送
+	OutMsgText OutMsgType = "text"
+	// OutMsgImage 图片消息, 使用 SendImage 发送
+	OutMsgImage OutMsgType = "image"
+)
+
+// Priority Outbox 中消息的优先级, 总是先发送优先级高的消息
+type Priority int
+
+const (
+	// PriorityLow 低优先级, 如群发消息
+	PriorityLow Priority = -1
+	// PriorityNormal 默认优先级
+	PriorityNormal Priority = 0
+	// PriorityHigh 高优先级, 如回复消息
+	PriorityHigh Priority = 1
+)
+
+// lane 返回优先级对应的队列, 超出范围的优先级按最近的处理
+func (p Priority) lane() int {
+	switch {
+	case p < PriorityLow:
+		p = PriorityLow
+	case p > PriorityHigh:
+		p = PriorityHigh
+	}
+	return int(p - PriorityLow)
+}
+
+// OutMsg Outbox 中待发送的消息
+type OutMsg struct {
+	// ID 消息 ID, 为空时由 Enqueue 生成
+	ID   string     `json:"id"`
+	Type OutMsgType `json:"type"`
+	Req  SendMsgReq `json:"req"`
+	// Priority 优先级, 同一接收者同一优先级的消息按加入顺序发送
+	Priority Priority `json:"priority"`
+	// Tag 调用方自定义的标记, 会原样出现在发送结果中
+	Tag string `json:"tag,omitempty"`
+	// Attempts 已尝试发送的次数
+	Attempts  int       `json:"attempts"`
+	CreatedAt time.Time `json:"created_at"`
+	// NotBefore 重试的消息在此时间之后才会发送
+	NotBefore time.Time `json:"not_before"`
+}
+
+// OutText 返回发送给 to 的文字消息, atList 为群消息中 @ 的成员
+func OutText(to, content string, atList ...string) OutMsg {
+	return OutMsg{Type: OutMsgText, Req: SendMsgReq{ToUserName: to, Content: content, AtList: atList}}
+}
+
+// OutImage 返回发送给 to 的图片消息, file 为图片 base64 数据
+func OutImage(to, file string) OutMsg {
+	return OutMsg{Type: OutMsgImage, Req: SendMsgReq{ToUserName: to, File: file}}
+}
+
+// OutResult 消息的最终发送结果, 发送成功或不再重试时产生
+type OutResult struct {
+	Msg  OutMsg
+	Resp *SendMsgResp
+	Err  error
+}
+
+// OutboxConfig Outbox 配置, 为零值的项不生效
+type OutboxConfig struct {
+	// Interval 所有消息共用的限流, 平均每 Interval 发送一条
+	Interval time.Duration
+	// Burst 所有消息最多连续发送的数量
+	Burst int
+	// RecipientInterval 每个接收者单独的限流, 平均每 RecipientInterval 发送一条
+	RecipientInterval time.Duration
+	// RecipientBurst 每个接收者最多连续发送的数量
+	RecipientBurst int
+	// MinDelay 每次发送后随机等待的最短时间
+	MinDelay time.Duration
+	// MaxDelay 每次发送后随机等待的最长时间
+	MaxDelay time.Duration
+	// MaxRetries 超时, 连接断开或未登录时的最大重试次数
+	MaxRetries int
+	// MinBackoff 首次重试前的等待时间, 之后每次翻倍
+	MinBackoff time.Duration
+	// MaxBackoff 重试等待时间上限
+	MaxBackoff time.Duration
+	// QueueSize 最多排队的消息数量, 0 为不限制
+	QueueSize int
+	// Store 保存排队中的消息, 重启后继续发送, 为 nil 时不保存
+	Store OutboxStore
+}
+
+// DefaultOutboxConfig 默认 Outbox 配置
+var DefaultOutboxConfig = OutboxConfig{
+	Interval:          time.Second,
+	Burst:             5,
+	RecipientInterval: 3 * time.Second,
+	RecipientBurst:    2,
+	MinDelay:          500 * time.Millisecond,
+	MaxDelay:          2 * time.Second,
+	MaxRetries:        3,
+	MinBackoff:        2 * time.Second,
+	MaxBackoff:        time.Minute,
+}
+
+// Outbox 消息发送队列, 按优先级和限流依次发送消息, 避免短时间内发送大量消息触发风控
+type Outbox struct {
+	bot        *Bot
+	cfg        OutboxConfig
+	global     *rateLimiter
+	recipients *rateLimiter
+
+	mu    sync.Mutex
+	lanes [3][]*OutMsg
+	count int
+	// pending 排队中和正在发送的消息 ID
+	pending map[string]bool
+	closed  bool
+	waiters map[string]chan OutResult
+	results handlerList[func(OutResult)]
+
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewOutbox 新建 Outbox 并开始发送, 设置了 Store 时先读取其中未发送的消息
+func NewOutbox(bot *Bot, cfg OutboxConfig) (*Outbox, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	o := &Outbox{
+		bot:        bot,
+		cfg:        cfg,
+		global:     newRateLimiter(cfg.Interval, cfg.Burst),
+		recipients: newRateLimiter(cfg.RecipientInterval, cfg.RecipientBurst),
+		pending:    make(map[string]bool),
+		waiters:    make(map[string]chan OutResult),
+		wake:       make(chan struct{}, 1),
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	if cfg.Store != nil {
+		msgs, err := cfg.Store.Load()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		for i := range msgs {
+			o.push(&msgs[i], false)
+		}
+	}
+	go o.run()
+	return o, nil
+}
+
+// Enqueue 将消息加入队列, 返回消息 ID, 发送结果通过 OnResult 回调.
+// 相同 ID 的消息已在队列中或正在发送时不会重复加入, 如 Store 中恢复的消息
+func (o *Outbox) Enqueue(m OutMsg) (string, error) {
+	if m.Type != OutMsgText && m.Type != OutMsgImage {
+		return "", fmt.Errorf("padchat: unknown outbox msg type %q", m.Type)
+	}
+	if m.ID == "" {
+		m.ID = uuid.New().String()
+	}
+	m.Attempts = 0
+	m.CreatedAt = time.Now()
+	m.NotBefore = time.Time{}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return "", ErrOutboxClosed
+	}
+	if o.pending[m.ID] {
+		return m.ID, nil
+	}
+	if o.cfg.QueueSize > 0 && o.count >= o.cfg.QueueSize {
+		return "", ErrOutboxFull
+	}
+	if o.cfg.Store != nil {
+		if err := o.cfg.Store.Save(m); err != nil {
+			return "", err
+		}
+	}
+	o.push(&m, false)
+	o.signal()
+	return m.ID, nil
+}
+
+// Send 将消息加入队列并等待发送结果.
+// ctx 结束时返回 ctx.Err(), 消息仍会留在队列中发送. Outbox 或 Bot 关闭后未发送时返回 ErrOutboxClosed
+func (o *Outbox) Send(ctx context.Context, m OutMsg) (*SendMsgResp, error) {
+	if m.ID == "" {
+		m.ID = uuid.New().String()
+	}
+	ch := make(chan OutResult, 1)
+	o.mu.Lock()
+	o.waiters[m.ID] = ch
+	o.mu.Unlock()
+	defer func() {
+		o.mu.Lock()
+		delete(o.waiters, m.ID)
+		o.mu.Unlock()
+	}()
+	if _, err := o.Enqueue(m); err != nil {
+		return nil, err
+	}
+	select {
+	case r := <-ch:
+		return r.Resp, r.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-o.done:
+		// 停止发送后排队中的消息不会再有结果
+		select {
+		case r := <-ch:
+			return r.Resp, r.Err
+		default:
+			return nil, ErrOutboxClosed
+		}
+	}
+}
+
+// OnResult 消息发送结果回调, 在发送协程中同步执行, 不应阻塞, 回调中的 panic 交给 Bot 的 OnHandlerPanic
+func (o *Outbox) OnResult(f func(r OutResult)) (unsubscribe func()) {
+	return o.results.add(f)
+}
+
+// Len 返回排队中的消息数量, 包括等待重试的消息
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.count
+}
+
+// Close 停止发送并等待正在发送的消息完成或 ctx 结束.
+// 未发送的消息会丢弃, 设置了 Store 时保留在 Store 中, 下次 NewOutbox 时继续发送
+func (o *Outbox) Close(ctx context.Context) error {
+	o.mu.Lock()
+	o.closed = true
+	o.mu.Unlock()
+	o.cancel()
+	select {
+	case <-o.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// push 将消息放入所属优先级队列, front 为 true 时放在队首, 调用方需持有锁
+func (o *Outbox) push(m *OutMsg, front bool) {
+	lane := m.Priority.lane()
+	if front {
+		o.lanes[lane] = append([]*OutMsg{m}, o.lanes[lane]...)
+	} else {
+		o.lanes[lane] = append(o.lanes[lane], m)
+	}
+	o.count++
+	o.pending[m.ID] = true
+}
+
+// remove 从队列中移除 ids 中尚未发送的消息, 返回被移除的消息 ID, 正在发送的消息不受影响
+func (o *Outbox) remove(ids map[string]bool) []string {
+	var removed []string
+	o.mu.Lock()
+	for lane, msgs := range o.lanes {
+		var kept []*OutMsg
+		for _, m := range msgs {
+			if ids[m.ID] {
+				removed = append(removed, m.ID)
+				delete(o.pending, m.ID)
+				o.count--
+				continue
+			}
+			kept = append(kept, m)
+		}
+		o.lanes[lane] = kept
+	}
+	o.mu.Unlock()
+	if o.cfg.Store != nil {
+		for _, id := range removed {
+			if err := o.cfg.Store.Delete(id); err != nil {
+				o.bot.logger.Warn("outbox store delete failed", "id", id, "error", err)
+			}
+		}
+	}
+	return removed
+}
+
+func (o *Outbox) signal() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next 取出下一条可以发送的消息, 没有时返回需要等待的时间, 为 0 时等待新消息
+func (o *Outbox) next(now time.Time) (*OutMsg, time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.count == 0 {
+		return nil, 0
+	}
+	if d := o.global.delay("", now); d > 0 {
+		return nil, d
+	}
+	var wait time.Duration
+	later := func(d time.Duration) {
+		if wait == 0 || d < wait {
+			wait = d
+		}
+	}
+	// 接收者的第一条消息不能发送时, 跳过该接收者之后的消息以保持顺序
+	blocked := make(map[string]bool)
+	for lane := len(o.lanes) - 1; lane >= 0; lane-- {
+		for i, m := range o.lanes[lane] {
+			to := m.Req.ToUserName
+			if blocked[to] {
+				continue
+			}
+			if now.Before(m.NotBefore) {
+				blocked[to] = true
+				later(m.NotBefore.Sub(now))
+				continue
+			}
+			if d := o.recipients.delay(to, now); d > 0 {
+				blocked[to] = true
+				later(d)
+				continue
+			}
+			o.global.allow("", now)
+			o.recipients.allow(to, now)
+			o.lanes[lane] = append(o.lanes[lane][:i:i], o.lanes[lane][i+1:]...)
+			o.count--
+			return m, 0
+		}
+	}
+	return nil, wait
+}
+
+func (o *Outbox) run() {
+	defer close(o.done)
+	for o.ctx.Err() == nil && !o.isBotClosed() {
+		m, wait := o.next(time.Now())
+		if m == nil {
+			if !o.sleep(wait, true) {
+				return
+			}
+			continue
+		}
+		o.send(m)
+		if !o.sleep(o.delay(), false) {
+			return
+		}
+	}
+}
+
+// sleep 等待 d, d 为 0 时一直等待, wakeable 为 true 时有新消息也会返回.
+// Outbox 关闭或 Bot 关闭时返回 false
+func (o *Outbox) sleep(d time.Duration, wakeable bool) bool {
+	var timeout <-chan time.Time
+	if d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		timeout = t.C
+	} else if !wakeable {
+		return true
+	}
+	wake := o.wake
+	if !wakeable {
+		wake = nil
+	}
+	select {
+	case <-timeout:
+	case <-wake:
+	case <-o.ctx.Done():
+		return false
+	case <-o.bot.done:
+		return false
+	}
+	return true
+}
+
+// delay 返回 MinDelay 和 MaxDelay 之间的随机时间
+func (o *Outbox) delay() time.Duration {
+	d := o.cfg.MinDelay
+	if o.cfg.MaxDelay > d {
+		d += rand.N(o.cfg.MaxDelay - d)
+	}
+	return d
+}
+
+// backoff 返回第 attempts 次失败后重试前的等待时间
+func (o *Outbox) backoff(attempts int) time.Duration {
+	d := o.cfg.MinBackoff
+	for i := 1; i < attempts && d < o.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if o.cfg.MaxBackoff > 0 && d > o.cfg.MaxBackoff {
+		d = o.cfg.MaxBackoff
+	}
+	return d
+}
+
+func (o *Outbox) send(m *OutMsg) {
+	m.Attempts++
+	var resp *SendMsgResp
+	var err error
+	switch m.Type {
+	case OutMsgText:
+		// SendMsg 会修改 Content, 重试时使用原始的请求
+		req := m.Req
+		resp, err = o.bot.SendMsgCtx(o.ctx, &req)
+	case OutMsgImage:
+		resp, err = o.bot.SendImageCtx(o.ctx, m.Req)
+	}
+	if err != nil && (o.ctx.Err() != nil || o.isBotClosed()) {
+		// 关闭时中断的消息不计入重试次数, 留在 Store 中下次发送
+		m.Attempts--
+		o.requeue(m)
+		return
+	}
+	if err != nil && isTransient(err) && m.Attempts <= o.cfg.MaxRetries {
+		m.NotBefore = time.Now().Add(o.backoff(m.Attempts))
+		o.bot.logger.Warn("outbox send failed, retry later",
+			"id", m.ID, "to", m.Req.ToUserName, "attempts", m.Attempts, "error", err)
+		o.requeue(m)
+		return
+	}
+	if err != nil {
+		o.bot.logger.Error("outbox send failed", "id", m.ID, "to", m.Req.ToUserName, "error", err)
+	}
+	if o.cfg.Store != nil {
+		if err := o.cfg.Store.Delete(m.ID); err != nil {
+			o.bot.logger.Warn("outbox store delete failed", "id", m.ID, "error", err)
+		}
+	}
+	o.finish(OutResult{Msg: *m, Resp: resp, Err: err})
+}
+
+// requeue 将消息放回所属队列的队首
+func (o *Outbox) requeue(m *OutMsg) {
+	if o.cfg.Store != nil {
+		if err := o.cfg.Store.Save(*m); err != nil {
+			o.bot.logger.Warn("outbox store save failed", "id", m.ID, "error", err)
+		}
+	}
+	o.mu.Lock()
+	o.push(m, true)
+	o.mu.Unlock()
+}
+
+func (o *Outbox) finish(r OutResult) {
+	o.mu.Lock()
+	delete(o.pending, r.Msg.ID)
+	o.mu.Unlock()
+	o.results.each(func(f func(OutResult)) { f(r) }, func(v interface{}, stack []byte) {
+		o.bot.handlerPanic(nil, v, stack)
+	})
+	o.mu.Lock()
+	ch := o.waiters[r.Msg.ID]
+	o.mu.Unlock()
+	if ch != nil {
+		ch <- r
+	}
+}
+
+func (o *Outbox) isBotClosed() bool {
+	select {
+	case <-o.bot.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// isTransient 是否为重试可能成功的错误
+func isTransient(err error) bool {
+	return errors.Is(err, ErrTimeout) || errors.Is(err, ErrConnClosed) || errors.Is(err, ErrNotLoggedIn)
+}
@@ -0,0 +1,220 @@
+package padchat_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuotoo/padchat"
+	"github.com/tuotoo/padchat/padchattest"
+)
+
+// sentTo 返回服务端收到的 sendMsg 指令的接收者和内容
+func sentTo(s *padchattest.Server) []string {
+	var list []string
+	for _, req := range s.Requests("sendMsg") {
+		var data padchat.SendMsgReq
+		req.Bind(&data)
+		list = append(list, data.ToUserName+":"+data.Content)
+	}
+	return list
+}
+
+// newTestOutbox 新建 Outbox, 返回等待 n 条发送结果的函数
+func newTestOutbox(t *testing.T, bot *padchat.Bot, cfg padchat.OutboxConfig) (*padchat.Outbox, func(n int) []padchat.OutResult) {
+	o, err := padchat.NewOutbox(bot, cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { o.Close(context.Background()) })
+	results := make(chan padchat.OutResult, 100)
+	o.OnResult(func(r padchat.OutResult) { results <- r })
+	return o, func(n int) []padchat.OutResult {
+		var list []padchat.OutResult
+		for len(list) < n {
+			select {
+			case r := <-results:
+				list = append(list, r)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("got %d results, want %d", len(list), n)
+			}
+		}
+		return list
+	}
+}
+
+func TestOutboxOrder(t *testing.T) {
+	bot, s := newTestBot(t)
+	login(t, bot)
+
+	// 预先保存在 Store 中的消息在 Outbox 启动时一起加入队列
+	store := padchat.NewMemoryOutboxStore()
+	for i, m := range []padchat.OutMsg{
+		padchat.OutText("a", "low"),
+		padchat.OutText("b", "1"),
+		padchat.OutText("c", "high"),
+		padchat.OutText("b", "2"),
+	} {
+		m.ID = string(rune('0' + i))
+		m.Priority = []padchat.Priority{padchat.PriorityLow, 0, padchat.PriorityHigh, 0}[i]
+		require.NoError(t, store.Save(m))
+	}
+	o, wait := newTestOutbox(t, bot, padchat.OutboxConfig{Store: store})
+	wait(4)
+	assert.Equal(t, []string{"c:high", "b:1", "b:2", "a:low"}, sentTo(s))
+	assert.Equal(t, 0, o.Len())
+	msgs, err := store.Load()
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+}
+
+func TestOutboxRateLimit(t *testing.T) {
+	bot, s := newTestBot(t)
+	login(t, bot)
+	store := padchat.NewMemoryOutboxStore()
+	for i, to := range []string{"x", "x", "x", "y"} {
+		m := padchat.OutText(to, string(rune('1'+i)))
+		m.ID = m.Req.Content
+		require.NoError(t, store.Save(m))
+	}
+	start := time.Now()
+	_, wait := newTestOutbox(t, bot, padchat.OutboxConfig{
+		RecipientInterval: 100 * time.Millisecond,
+		RecipientBurst:    1,
+		MinDelay:          time.Millisecond,
+		MaxDelay:          5 * time.Millisecond,
+		Store:             store,
+	})
+	wait(4)
+	// 发给 x 的消息受限时先发送给 y
+	assert.Equal(t, []string{"x:1", "y:4", "x:2", "x:3"}, sentTo(s))
+	assert.True(t, time.Since(start) >= 200*time.Millisecond)
+}
+
+func TestOutboxRetry(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	bot, s := newTestBot(t)
+	o, wait := newTestOutbox(t, bot, padchat.OutboxConfig{
+		MaxRetries: 3,
+		MinBackoff: 100 * time.Millisecond,
+	})
+
+	// 未登录时发送失败, 登录后重试成功
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := o.Send(ctx, padchat.OutText("a", "hello"))
+		assert.NoError(t, err)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	login(t, bot)
+	wg.Wait()
+	r := wait(1)[0]
+	assert.Equal(t, 2, r.Msg.Attempts)
+	assert.Equal(t, []string{"a:hello"}, sentTo(s))
+
+	// 服务端返回的错误不重试
+	s.Handle("sendMsg", func(padchattest.Request) padchattest.Reply {
+		return padchattest.Fail("blocked")
+	})
+	_, err := o.Send(ctx, padchat.OutText("a", "again"))
+	var perr *padchat.Error
+	require.True(t, errors.As(err, &perr))
+	assert.Equal(t, "blocked", perr.Msg)
+	assert.Equal(t, 1, wait(1)[0].Msg.Attempts)
+}
+
+func TestOutboxClose(t *testing.T) {
+	bot, s := newTestBot(t)
+	login(t, bot)
+	path := filepath.Join(t.TempDir(), "outbox")
+	store, err := padchat.NewFileOutboxStore(path)
+	require.NoError(t, err)
+	o, wait := newTestOutbox(t, bot, padchat.OutboxConfig{
+		Interval:  time.Hour,
+		Burst:     1,
+		QueueSize: 3,
+		Store:     store,
+	})
+	for _, content := range []string{"1", "2", "3"} {
+		_, err := o.Enqueue(padchat.OutText("a", content))
+		require.NoError(t, err)
+	}
+	wait(1)
+	_, err = o.Enqueue(padchat.OutText("a", "4"))
+	require.NoError(t, err)
+	_, err = o.Enqueue(padchat.OutText("a", "5"))
+	assert.Equal(t, padchat.ErrOutboxFull, err)
+	_, err = o.Enqueue(padchat.OutMsg{Type: "video"})
+	assert.Error(t, err)
+
+	require.NoError(t, o.Close(context.Background()))
+	_, err = o.Enqueue(padchat.OutText("a", "6"))
+	assert.Equal(t, padchat.ErrOutboxClosed, err)
+	assert.Equal(t, []string{"a:1"}, sentTo(s))
+
+	// 重新打开后未发送的消息按顺序继续发送
+	require.NoError(t, store.Close())
+	store, err = padchat.NewFileOutboxStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+	msgs, err := store.Load()
+	require.NoError(t, err)
+	var contents []string
+	for _, m := range msgs {
+		contents = append(contents, m.Req.Content)
+	}
+	assert.Equal(t, []string{"2", "3", "4"}, contents)
+	_, wait = newTestOutbox(t, bot, padchat.OutboxConfig{Store: store})
+	wait(3)
+	assert.Equal(t, []string{"a:1", "a:2", "a:3", "a:4"}, sentTo(s))
+}
+
+func TestOutboxResultPanic(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	bot, _ := newTestBot(t)
+	login(t, bot)
+	panics := make(chan padchat.HandlerPanicEvent, 1)
+	bot.OnHandlerPanic(func(e padchat.HandlerPanicEvent) { panics <- e })
+	o, wait := newTestOutbox(t, bot, padchat.OutboxConfig{})
+	o.OnResult(func(padchat.OutResult) { panic("boom") })
+
+	// 回调 panic 不影响发送结果和其他回调
+	_, err := o.Send(ctx, padchat.OutText("a", "hello"))
+	require.NoError(t, err)
+	assert.Len(t, wait(1), 1)
+	e := <-panics
+	assert.Equal(t, "boom", e.Value)
+	assert.Nil(t, e.Event)
+}
+
+func TestOutboxSendClosed(t *testing.T) {
+	bot, _ := newTestBot(t)
+	login(t, bot)
+	o, wait := newTestOutbox(t, bot, padchat.OutboxConfig{Interval: time.Hour, Burst: 1})
+	_, err := o.Enqueue(padchat.OutText("a", "1"))
+	require.NoError(t, err)
+	wait(1)
+
+	// 排队中的消息在 Close 后不会发送, Send 不应一直等待
+	errc := make(chan error, 1)
+	go func() {
+		_, err := o.Send(context.Background(), padchat.OutText("a", "2"))
+		errc <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, o.Close(context.Background()))
+	select {
+	case err := <-errc:
+		assert.Equal(t, padchat.ErrOutboxClosed, err)
+	case <-time.After(time.Second):
+		t.Fatal("Send not returned after Close")
+	}
+}
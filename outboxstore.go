@@ -0,0 +1,231 @@
+package padchat
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+)
+
+// OutboxStore 保存 Outbox 中排队的消息, 通过 OutboxConfig.Store 使用
+type OutboxStore interface {
+	// Load 读取所有保存的消息, 按第一次保存的顺序排列
+	Load() ([]OutMsg, error)
+	// Save 保存消息, 已存在相同 ID 的消息时覆盖
+	Save(m OutMsg) error
+	// Delete 删除消息, 消息不存在时不返回错误
+	Delete(id string) error
+}
+
+type outboxEntry struct {
+	seq int
+	msg OutMsg
+}
+
+// MemoryOutboxStore 内存中的消息存储, 用于在同一进程中重建 Outbox 时保留消息
+type MemoryOutboxStore struct {
+	mu      sync.Mutex
+	seq     int
+	entries map[string]outboxEntry
+}
+
+// NewMemoryOutboxStore 新建内存消息存储
+func NewMemoryOutboxStore() *MemoryOutboxStore {
+	return &MemoryOutboxStore{entries: make(map[string]outboxEntry)}
+}
+
+// Load 实现 OutboxStore
+func (s *MemoryOutboxStore) Load() ([]OutMsg, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := make([]outboxEntry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].seq < entries[j].seq
+	})
+	msgs := make([]OutMsg, len(entries))
+	for i, e := range entries {
+		msgs[i] = e.msg
+	}
+	return msgs, nil
+}
+
+// Save 实现 OutboxStore
+func (s *MemoryOutboxStore) Save(m OutMsg) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[m.ID]
+	if !ok {
+		s.seq++
+		e.seq = s.seq
+	}
+	e.msg = m
+	s.entries[m.ID] = e
+	return nil
+}
+
+// Delete 实现 OutboxStore
+func (s *MemoryOutboxStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, id)
+	return nil
+}
+
+func (s *MemoryOutboxStore) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// outboxRecord FileOutboxStore 文件中的一行
+type outboxRecord struct {
+	Msg *OutMsg `json:"msg,omitempty"`
+	// Delete 被删除的消息 ID
+	Delete string `json:"delete,omitempty"`
+}
+
+// FileOutboxStore 保存到文件的消息存储, 程序重启后继续发送
+// 每次保存和删除以一行 JSON 追加写入文件, 文件过大时按未发送的消息重写
+type FileOutboxStore struct {
+	mu    sync.Mutex
+	path  string
+	mem   *MemoryOutboxStore
+	file  *os.File
+	lines int
+}
+
+// NewFileOutboxStore 打开或新建文件消息存储, 使用完毕后需调用 Close
+func NewFileOutboxStore(path string) (*FileOutboxStore, error) {
+	s := &FileOutboxStore{
+		path: path,
+		mem:  NewMemoryOutboxStore(),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load 从文件读取记录, 无法解析的行会被忽略
+func (s *FileOutboxStore) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	// 图片消息带有 base64 数据, 单行可能很长
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var r outboxRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		switch {
+		case r.Msg != nil:
+			s.mem.Save(*r.Msg)
+		case r.Delete != "":
+			s.mem.Delete(r.Delete)
+		}
+	}
+	return scanner.Err()
+}
+
+// Load 实现 OutboxStore
+func (s *FileOutboxStore) Load() ([]OutMsg, error) {
+	return s.mem.Load()
+}
+
+// Save 实现 OutboxStore
+func (s *FileOutboxStore) Save(m OutMsg) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.append(outboxRecord{Msg: &m}); err != nil {
+		return err
+	}
+	return s.mem.Save(m)
+}
+
+// Delete 实现 OutboxStore
+func (s *FileOutboxStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.append(outboxRecord{Delete: id}); err != nil {
+		return err
+	}
+	s.mem.Delete(id)
+	if s.lines > 2*s.mem.len()+64 {
+		return s.compact()
+	}
+	return nil
+}
+
+// append 追加一行记录, 调用方需持有锁
+func (s *FileOutboxStore) append(r outboxRecord) error {
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	s.lines++
+	return nil
+}
+
+// compact 将未发送的消息写入临时文件并替换原文件, 调用方需持有锁
+func (s *FileOutboxStore) compact() error {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	msgs, _ := s.mem.Load()
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for i := range msgs {
+		enc.Encode(outboxRecord{Msg: &msgs[i]})
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.file, err = os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	s.lines = len(msgs)
+	return err
+}
+
+// Close 关闭文件
+func (s *FileOutboxStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
@@ -0,0 +1,116 @@
+package padchattest
+
+import (
+	"github.com/tuotoo/padchat"
+)
+
+// Event 服务端发送的用户事件
+type Event struct {
+	// Name 事件名称, 如 qrcode, scan, login, push
+	Name string
+	// Data 事件数据, 会被序列化为 JSON
+	Data interface{}
+	typ  string
+}
+
+func (e Event) frame() frame {
+	typ := e.typ
+	if typ == "" {
+		typ = "userEvent"
+	}
+	data := e.Data
+	if data == nil {
+		data = struct{}{}
+	}
+	return frame{Type: typ, Event: e.Name, Data: data}
+}
+
+// QRCodeEvent 二维码事件, url 为二维码内容
+func QRCodeEvent(url string) Event {
+	return Event{Name: "qrcode", Data: struct {
+		URL string `json:"url"`
+	}{URL: url}}
+}
+
+// ScanEvent 扫码状态事件
+func ScanEvent(scan padchat.ScanResp) Event {
+	return Event{Name: "scan", Data: scan}
+}
+
+// LoginEvent 登录成功事件
+func LoginEvent() Event {
+	return Event{Name: "login"}
+}
+
+// LoadedEvent 联系人加载完成事件
+func LoadedEvent() Event {
+	return Event{Name: "loaded"}
+}
+
+// LogoutEvent 退出登录事件
+func LogoutEvent(msg string) Event {
+	return Event{Name: "logout", Data: struct {
+		Msg string `json:"msg"`
+	}{Msg: msg}}
+}
+
+// WarnEvent 警告事件
+func WarnEvent(msg string) Event {
+	return Event{Name: "warn", Data: struct {
+		Error string `json:"error"`
+	}{Error: msg}}
+}
+
+// PushEvent 推送事件, 每个 item 为推送列表中的一项, 需带有 msg_type 字段
+func PushEvent(items ...interface{}) Event {
+	return Event{Name: "push", Data: struct {
+		List []interface{} `json:"list"`
+	}{List: items}}
+}
+
+// MsgPush 将消息包装为推送列表项, msg_type 为 PushTypeMsg
+func MsgPush(msg padchat.Msg) interface{} {
+	msg.MsgType = padchat.PushTypeMsg
+	if len(msg.Content) == 0 {
+		msg.Content = []byte(`""`)
+	}
+	return msg
+}
+
+// ContactPush 将联系人包装为推送列表项, msg_type 为 PushTypeContact
+func ContactPush(contact padchat.Contact) interface{} {
+	contact.MsgType = padchat.PushTypeContact
+	return contact
+}
+
+// ContactDeletePush 删除联系人的推送列表项, msg_type 为 PushTypeContactDelete
+func ContactDeletePush(userName string) interface{} {
+	return struct {
+		MsgType  int    `json:"msg_type"`
+		UserName string `json:"user_name"`
+	}{padchat.PushTypeContactDelete, userName}
+}
+
+// SelfProfilePush 将自己的资料包装为推送列表项, msg_type 为 PushTypeSelfProfile
+func SelfProfilePush(profile padchat.Contact) interface{} {
+	profile.MsgType = padchat.PushTypeSelfProfile
+	return profile
+}
+
+// PushMsg 向所有客户端推送消息
+func (s *Server) PushMsg(msgs ...padchat.Msg) error {
+	items := make([]interface{}, len(msgs))
+	for i, msg := range msgs {
+		items[i] = MsgPush(msg)
+	}
+	return s.Emit(PushEvent(items...))
+}
+
+// PushContact 向所有客户端推送联系人
+func (s *Server) PushContact(contacts ...padchat.Contact) error {
+	items := make([]interface{}, len(contacts))
+	for i, contact := range contacts {
+		items[i] = ContactPush(contact)
+	}
+	return s.Emit(PushEvent(items...))
+}
@@ -0,0 +1,321 @@
+// Package padchattest 提供用于测试的 PadChat 服务端
+//
+// Server 基于 httptest 运行, 实现了 PadChat 的 ws 协议: 应答带有 cmdId 的指令,
+// 并可主动发送 qrcode, scan, login, push, loaded, logout, warn 等用户事件,
+// 使 Bot 及基于 Bot 的程序无需连接真实服务端即可测试.
+package padchattest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrNoConn 没有已连接的客户端
+var ErrNoConn = errors.New("padchattest: no client connected")
+
+// Request 客户端发送的指令
+type Request struct {
+	Type  string          `json:"type"`
+	Cmd   string          `json:"cmd"`
+	CmdID string          `json:"cmdId"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// Bind 将指令参数解析到 v 中
+func (r Request) Bind(v interface{}) error {
+	return json.Unmarshal(r.Data, v)
+}
+
+// Reply 指令应答
+type Reply struct {
+	// Success 指令是否执行成功
+	Success bool
+	// Data 返回数据, 会被序列化为 JSON
+	Data interface{}
+	// Msg 错误信息
+	Msg string
+	// Delay 应答前的等待时间
+	Delay time.Duration
+	// NoReply 为 true 时不应答, 用于模拟超时
+	NoReply bool
+	// Then 应答后依次发送的用户事件
+	Then []Event
+}
+
+// Handler 处理指令并返回应答
+type Handler func(req Request) Reply
+
+// OK 返回执行成功的应答
+func OK(data interface{}, then ...Event) Reply {
+	return Reply{Success: true, Data: data, Then: then}
+}
+
+// Fail 返回执行失败的应答
+func Fail(msg string) Reply {
+	return Reply{Success: false, Msg: msg}
+}
+
+// frame 服务端发送的数据帧
+type frame struct {
+	Type  string      `json:"type"`
+	Event string      `json:"event,omitempty"`
+	CmdID string      `json:"cmdId,omitempty"`
+	Data  interface{} `json:"data"`
+}
+
+// conn 已连接的客户端
+type conn struct {
+	sync.Mutex
+	*websocket.Conn
+}
+
+func (c *conn) write(f frame) error {
+	b, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	c.Lock()
+	defer c.Unlock()
+	return c.WriteMessage(websocket.TextMessage, b)
+}
+
+// Server 模拟的 PadChat 服务端
+type Server struct {
+	// URL ws 连接地址, 形如 ws://127.0.0.1:port
+	URL string
+
+	srv        *httptest.Server
+	mu         sync.Mutex
+	handlers   map[string]Handler
+	conns      map[*conn]struct{}
+	requests   []Request
+	connected  chan struct{}
+	received   chan struct{}
+	ignorePing bool
+}
+
+// NewServer 启动模拟服务端, 使用完毕后需调用 Close
+// 默认应答所有指令为成功, 其中 login 指令应答后会发送 login 事件
+func NewServer() *Server {
+	s := &Server{
+		handlers:  make(map[string]Handler),
+		conns:     make(map[*conn]struct{}),
+		connected: make(chan struct{}),
+		received:  make(chan struct{}),
+	}
+	s.Handle("login", func(Request) Reply {
+		return OK(nil, LoginEvent())
+	})
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveWS))
+	s.URL = "ws" + strings.TrimPrefix(s.srv.URL, "http")
+	return s
+}
+
+// Close 断开所有客户端并关闭服务端
+func (s *Server) Close() {
+	s.DropConns()
+	s.srv.Close()
+}
+
+// Handle 设置指令的处理函数, 未设置处理函数的指令均应答为成功
+func (s *Server) Handle(cmd string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[cmd] = h
+}
+
+// Reply 设置指令固定返回 data
+func (s *Server) Reply(cmd string, data interface{}) {
+	s.Handle(cmd, func(Request) Reply {
+		return OK(data)
+	})
+}
+
+// Requests 返回收到的所有指令, cmd 不为空时只返回该指令
+func (s *Server) Requests(cmd string) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var reqs []Request
+	for _, r := range s.requests {
+		if cmd == "" || r.Cmd == cmd {
+			reqs = append(reqs, r)
+		}
+	}
+	return reqs
+}
+
+// WaitRequest 等待收到指定指令, 超时返回 false
+func (s *Server) WaitRequest(cmd string, timeout time.Duration) (Request, bool) {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		for _, r := range s.requests {
+			if r.Cmd == cmd {
+				s.mu.Unlock()
+				return r, true
+			}
+		}
+		received := s.received
+		s.mu.Unlock()
+		select {
+		case <-received:
+		case <-deadline:
+			return Request{}, false
+		}
+	}
+}
+
+// ConnCount 返回当前已连接的客户端数量
+func (s *Server) ConnCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// WaitConn 等待至少有一个客户端连接, 超时返回 false
+func (s *Server) WaitConn(timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		n := len(s.conns)
+		connected := s.connected
+		s.mu.Unlock()
+		if n > 0 {
+			return true
+		}
+		select {
+		case <-connected:
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+// IgnorePing 设置之后建立的连接是否忽略 ping, 用于模拟半开连接
+func (s *Server) IgnorePing(ignore bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ignorePing = ignore
+}
+
+// DropConns 强制断开所有客户端, 用于模拟网络中断
+func (s *Server) DropConns() {
+	s.mu.Lock()
+	conns := s.conns
+	s.conns = make(map[*conn]struct{})
+	s.mu.Unlock()
+	for c := range conns {
+		c.Close()
+	}
+}
+
+// Emit 向所有客户端依次发送用户事件
+func (s *Server) Emit(events ...Event) error {
+	s.mu.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	if len(conns) == 0 {
+		return ErrNoConn
+	}
+	for _, c := range conns {
+		for _, e := range events {
+			if err := c.write(e.frame()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SendRaw 向所有客户端发送任意类型的数据帧
+func (s *Server) SendRaw(typ, event string, data interface{}) error {
+	return s.Emit(Event{typ: typ, Name: event, Data: data})
+}
+
+func (s *Server) serveWS(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{}
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &conn{Conn: ws}
+	s.mu.Lock()
+	if s.ignorePing {
+		ws.SetPingHandler(func(string) error { return nil })
+	}
+	s.conns[c] = struct{}{}
+	close(s.connected)
+	s.connected = make(chan struct{})
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		ws.Close()
+	}()
+	for {
+		var req Request
+		if err := ws.ReadJSON(&req); err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.requests = append(s.requests, req)
+		close(s.received)
+		s.received = make(chan struct{})
+		h := s.handlers[req.Cmd]
+		s.mu.Unlock()
+		reply := OK(nil)
+		if h != nil {
+			reply = h(req)
+		}
+		if reply.NoReply {
+			continue
+		}
+		go s.reply(c, req, reply)
+	}
+}
+
+func (s *Server) reply(c *conn, req Request, reply Reply) {
+	if reply.Delay > 0 {
+		time.Sleep(reply.Delay)
+	}
+	data := reply.Data
+	if data == nil {
+		data = struct{}{}
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	err = c.write(frame{
+		Type:  "cmdRet",
+		CmdID: req.CmdID,
+		Data: struct {
+			Success bool            `json:"success"`
+			Data    json.RawMessage `json:"data"`
+			Msg     string          `json:"msg,omitempty"`
+		}{
+			Success: reply.Success,
+			Data:    b,
+			Msg:     reply.Msg,
+		},
+	})
+	if err != nil {
+		return
+	}
+	for _, e := range reply.Then {
+		if err := c.write(e.frame()); err != nil {
+			return
+		}
+	}
+}
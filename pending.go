@@ -0,0 +1,116 @@
+package padchat
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// CommandStats 指令统计
+type CommandStats struct {
+	// Pending 等待返回的指令数
+	Pending int
+	// Sent 已发送的指令数
+	Sent uint64
+	// WriteErrors 发送失败的指令数
+	WriteErrors uint64
+	// Timeouts 超时或被取消的指令数
+	Timeouts uint64
+	// LateReplies 返回时已不在等待中的指令数, 一般是超时后才返回
+	LateReplies uint64
+}
+
+// pendingCall 等待返回的指令, ch 仅会收到一次结果
+type pendingCall struct {
+	cmd string
+	ch  chan CommandResp
+}
+
+// pendingTable 等待返回的指令表
+type pendingTable struct {
+	mu          sync.Mutex
+	calls       map[string]*pendingCall
+	sent        uint64
+	writeErrors uint64
+	timeouts    uint64
+	lateReplies uint64
+	// initID 当前连接 init 指令的 ID, 没有调用方等待其返回, 返回时不计入统计
+	initID string
+}
+
+func newPendingTable() *pendingTable {
+	return &pendingTable{calls: make(map[string]*pendingCall)}
+}
+
+// add 登记等待返回的指令
+func (t *pendingTable) add(id, cmd string) *pendingCall {
+	c := &pendingCall{cmd: cmd, ch: make(chan CommandResp, 1)}
+	t.mu.Lock()
+	t.calls[id] = c
+	t.mu.Unlock()
+	atomic.AddUint64(&t.sent, 1)
+	return c
+}
+
+// setInit 记录新连接发送的 init 指令
+func (t *pendingTable) setInit(id string) {
+	t.mu.Lock()
+	t.initID = id
+	t.mu.Unlock()
+}
+
+// remove 移除指令, 指令仍在等待中时返回 true
+func (t *pendingTable) remove(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.calls[id]
+	delete(t.calls, id)
+	return ok
+}
+
+// deliver 将返回结果交给等待中的指令, 指令已不在等待中时记为迟到的返回
+func (t *pendingTable) deliver(id string, resp CommandResp) bool {
+	t.mu.Lock()
+	if id != "" && id == t.initID {
+		t.initID = ""
+		t.mu.Unlock()
+		return true
+	}
+	c, ok := t.calls[id]
+	delete(t.calls, id)
+	t.mu.Unlock()
+	if !ok {
+		atomic.AddUint64(&t.lateReplies, 1)
+		return false
+	}
+	c.ch <- resp
+	return true
+}
+
+func (t *pendingTable) writeFailed(id string) {
+	t.remove(id)
+	atomic.AddUint64(&t.writeErrors, 1)
+}
+
+func (t *pendingTable) timedOut(id string) {
+	if t.remove(id) {
+		atomic.AddUint64(&t.timeouts, 1)
+	}
+}
+
+func (t *pendingTable) stats() CommandStats {
+	t.mu.Lock()
+	n := len(t.calls)
+	t.mu.Unlock()
+	return CommandStats{
+		Pending:     n,
+		Sent:        atomic.LoadUint64(&t.sent),
+		WriteErrors: atomic.LoadUint64(&t.writeErrors),
+		Timeouts:    atomic.LoadUint64(&t.timeouts),
+		LateReplies: atomic.LoadUint64(&t.lateReplies),
+	}
+}
+
+// CommandStats 返回指令统计
+func (bot *Bot) CommandStats() CommandStats {
+	return bot.pending.stats()
+}
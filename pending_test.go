@@ -0,0 +1,29 @@
+package padchat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPendingTable(t *testing.T) {
+	table := newPendingTable()
+	call := table.add("1", "init")
+	assert.Equal(t, 1, table.stats().Pending)
+	assert.True(t, table.deliver("1", CommandResp{Success: true}))
+	assert.True(t, (<-call.ch).Success)
+	assert.False(t, table.deliver("1", CommandResp{}))
+
+	table.add("2", "init")
+	table.timedOut("2")
+	assert.False(t, table.deliver("2", CommandResp{}))
+
+	table.add("3", "init")
+	table.writeFailed("3")
+	assert.Equal(t, CommandStats{
+		Sent:        3,
+		WriteErrors: 1,
+		Timeouts:    1,
+		LateReplies: 2,
+	}, table.stats())
+}
@@ -0,0 +1,184 @@
+package padchat
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/json-iterator/go"
+)
+
+// 推送类型, 对应推送列表中每一项的 msg_type, 与微信同步指令的类型一致
+const (
+	// PushTypeSelfProfile 自己的资料变化
+	PushTypeSelfProfile = 1
+	// PushTypeContact 好友, 群或公众号信息
+	PushTypeContact = 2
+	// PushTypeContactDelete 删除好友或退出群
+	PushTypeContactDelete = 4
+	// PushTypeMsg 微信消息
+	PushTypeMsg = 5
+	// PushTypeSyncMark 同步进度标记, continue 为 0 时本轮同步结束
+	PushTypeSyncMark = 2048
+	// PushTypeSyncEnd 同步结束标记
+	PushTypeSyncEnd = 32768
+)
+
+// ContactDeleteEvent 删除好友或退出群
+type ContactDeleteEvent struct {
+	UserName string
+	Raw      json.RawMessage
+}
+
+// RoomMemberChangeEvent 群成员变化, 通过比较群推送与联系人缓存中的成员列表得出,
+// 缓存中没有该群时不产生事件
+type RoomMemberChangeEvent struct {
+	RoomID string
+	Room   Contact
+	// Joined 新加入的成员 ID
+	Joined []string
+	// Left 退出或被移出的成员 ID
+	Left []string
+}
+
+// SelfProfileUpdateEvent 自己的资料变化
+type SelfProfileUpdateEvent struct {
+	Profile Contact
+	Raw     json.RawMessage
+}
+
+// SyncFinishedEvent 同步标记, MsgType 为 PushTypeSyncMark 或 PushTypeSyncEnd
+type SyncFinishedEvent struct {
+	MsgType  int
+	Continue int
+}
+
+// RawPushEvent 推送列表中的原始数据, 每一项推送都会产生
+type RawPushEvent struct {
+	Push json.RawMessage
+}
+
+func (ContactDeleteEvent) event()     {}
+func (RoomMemberChangeEvent) event()  {}
+func (SelfProfileUpdateEvent) event() {}
+func (SyncFinishedEvent) event()      {}
+func (RawPushEvent) event()           {}
+
+// IsRoom 是否为群
+func (c Contact) IsRoom() bool {
+	return strings.HasSuffix(c.UserName, chatroomSuffix)
+}
+
+// Members 返回群推送中的成员 ID 列表
+func (c Contact) Members() []string {
+	if c.Member == "" {
+		return nil
+	}
+	var ids []string
+	if err := jsoniter.Unmarshal([]byte(c.Member), &ids); err == nil {
+		return ids
+	}
+	// 成员列表不是 JSON 数组时按分隔符拆分
+	for _, id := range strings.FieldsFunc(c.Member, func(r rune) bool {
+		return r == ',' || r == ';'
+	}) {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// diffStrings 返回在 a 中但不在 b 中的元素
+func diffStrings(a, b []string) []string {
+	set := make(map[string]bool, len(b))
+	for _, s := range b {
+		set[s] = true
+	}
+	var diff []string
+	for _, s := range a {
+		if !set[s] {
+			diff = append(diff, s)
+		}
+	}
+	return diff
+}
+
+// processPush 将推送列表中的一项解析为对应的事件并分发
+func (bot *Bot) processPush(v json.RawMessage) {
+	// 每项推送都会产生 RawPushEvent, 没有订阅时不分发
+	if !bot.subs.rawPush.empty() || bot.hasEventsChan() {
+		bot.dispatch(RawPushEvent{Push: v})
+	}
+	msgType := jsoniter.Get(v, "msg_type").ToInt()
+	switch msgType {
+	case PushTypeMsg:
+		var msg Msg
+		jsoniter.Unmarshal(v, &msg)
+		msg.MType = msg.SubType
+		if bot.isDuplicate(msg) {
+			return
+		}
+		bot.dispatch(MsgEvent{Msg: msg})
+	case PushTypeContact:
+		var contact Contact
+		jsoniter.Unmarshal(v, &contact)
+		old, known := bot.contacts.put(contact)
+		bot.dispatch(ContactSyncEvent{Contact: contact})
+		if !contact.IsRoom() || !known {
+			return
+		}
+		members := contact.Members()
+		joined := diffStrings(members, old.Members())
+		left := diffStrings(old.Members(), members)
+		if len(joined) > 0 || len(left) > 0 {
+			bot.dispatch(RoomMemberChangeEvent{
+				RoomID: contact.UserName,
+				Room:   contact,
+				Joined: joined,
+				Left:   left,
+			})
+		}
+	case PushTypeContactDelete:
+		userName := jsoniter.Get(v, "user_name").ToString()
+		bot.contacts.Remove(userName)
+		bot.dispatch(ContactDeleteEvent{UserName: userName, Raw: v})
+	case PushTypeSelfProfile:
+		var profile Contact
+		jsoniter.Unmarshal(v, &profile)
+		bot.dispatch(SelfProfileUpdateEvent{Profile: profile, Raw: v})
+	case PushTypeSyncMark, PushTypeSyncEnd:
+		bot.dispatch(SyncFinishedEvent{
+			MsgType:  msgType,
+			Continue: jsoniter.Get(v, "continue").ToInt(),
+		})
+	default:
+		bot.logger.Warn("unknown push", "msg_type", msgType, "size", len(v))
+		bot.dispatch(UnknownPushEvent{Push: v})
+	}
+}
+
+// OnContactDelete 删除好友或退出群回调
+func (bot *Bot) OnContactDelete(f func(userName string)) (unsubscribe func()) {
+	return bot.subs.contactDelete.add(f)
+}
+
+// OnRoomMemberChange 群成员变化回调
+func (bot *Bot) OnRoomMemberChange(f func(e RoomMemberChangeEvent)) (unsubscribe func()) {
+	return bot.subs.roomMember.add(f)
+}
+
+// OnSelfProfileUpdate 自己的资料变化回调
+func (bot *Bot) OnSelfProfileUpdate(f func(profile Contact)) (unsubscribe func()) {
+	return bot.subs.selfProfile.add(f)
+}
+
+// OnSyncFinished 同步标记回调, msgType 为 PushTypeSyncMark 或 PushTypeSyncEnd
+func (bot *Bot) OnSyncFinished(f func(msgType, cont int)) (unsubscribe func()) {
+	return bot.subs.syncFinished.add(f)
+}
+
+// OnRawPush 收到推送回调, 推送列表中的每一项都会以原始数据回调, 先于解析后的回调分发.
+// 与 OnUnknownPush 不同, 已识别类型的推送也会回调
+func (bot *Bot) OnRawPush(f func(push json.RawMessage)) (unsubscribe func()) {
+	return bot.subs.rawPush.add(f)
+}
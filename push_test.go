@@ -0,0 +1,69 @@
+package padchat_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuotoo/padchat"
+	"github.com/tuotoo/padchat/padchattest"
+)
+
+func TestContactMembers(t *testing.T) {
+	room := padchat.Contact{UserName: "123@chatroom", Member: `["wxid_a","wxid_b"]`}
+	assert.True(t, room.IsRoom())
+	assert.Equal(t, []string{"wxid_a", "wxid_b"}, room.Members())
+	room.Member = "wxid_a;wxid_c"
+	assert.Equal(t, []string{"wxid_a", "wxid_c"}, room.Members())
+	assert.False(t, padchat.Contact{UserName: "wxid_a"}.IsRoom())
+}
+
+func TestPushTypes(t *testing.T) {
+	bot, s := newTestBot(t)
+	deleted := make(chan string, 1)
+	changed := make(chan padchat.RoomMemberChangeEvent, 2)
+	profile := make(chan padchat.Contact, 1)
+	synced := make(chan int, 2)
+	raw := make(chan json.RawMessage, 10)
+	unknown := make(chan json.RawMessage, 1)
+	bot.OnContactDelete(func(userName string) { deleted <- userName })
+	bot.OnRoomMemberChange(func(e padchat.RoomMemberChangeEvent) { changed <- e })
+	bot.OnSelfProfileUpdate(func(c padchat.Contact) { profile <- c })
+	bot.OnSyncFinished(func(msgType, cont int) { synced <- msgType })
+	bot.OnRawPush(func(push json.RawMessage) { raw <- push })
+	bot.OnUnknownPush(func(push json.RawMessage) { unknown <- push })
+
+	require.NoError(t, s.PushContact(padchat.Contact{UserName: "123@chatroom", Member: `["wxid_a","wxid_b"]`}))
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, s.Emit(padchattest.PushEvent(
+		padchattest.ContactPush(padchat.Contact{UserName: "123@chatroom", Member: `["wxid_a","wxid_c"]`}),
+		padchattest.ContactDeletePush("wxid_d"),
+		padchattest.SelfProfilePush(padchat.Contact{UserName: "wxid_bot", NickName: "bot"}),
+		map[string]interface{}{"msg_type": padchat.PushTypeSyncEnd, "continue": 0},
+		map[string]interface{}{"msg_type": 99},
+	)))
+
+	e := <-changed
+	assert.Equal(t, "123@chatroom", e.RoomID)
+	assert.Equal(t, []string{"wxid_c"}, e.Joined)
+	assert.Equal(t, []string{"wxid_b"}, e.Left)
+	assert.Equal(t, "wxid_d", <-deleted)
+	assert.Equal(t, "bot", (<-profile).NickName)
+	assert.Equal(t, padchat.PushTypeSyncEnd, <-synced)
+	assert.Contains(t, string(<-unknown), "99")
+	for i := 0; i < 6; i++ {
+		select {
+		case <-raw:
+		case <-time.After(time.Second):
+			t.Fatalf("raw push %d not received", i)
+		}
+	}
+	select {
+	case e := <-changed:
+		t.Fatalf("unexpected member change %+v", e)
+	default:
+	}
+}
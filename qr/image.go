@@ -0,0 +1,117 @@
+package qr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"strings"
+
+	// 注册 GetRoomQRCode 等指令可能返回的图片格式
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// ErrNotFound 图片中没有找到二维码
+var ErrNotFound = errors.New("qr: qr code not found in image")
+
+// FromBase64 识别 base64 编码的二维码图片, 如 GetRoomQRCode 和 GetUserQRCode 返回的 QRCode,
+// 可带有 `data:image/png;base64,` 前缀
+func FromBase64(s string) (*Code, error) {
+	if i := strings.Index(s, ";base64,"); strings.HasPrefix(s, "data:") && i >= 0 {
+		s = s[i+len(";base64,"):]
+	}
+	s = strings.TrimSpace(s)
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		if data, err = base64.RawStdEncoding.DecodeString(s); err != nil {
+			return nil, fmt.Errorf("qr: decode base64: %w", err)
+		}
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("qr: decode image: %w", err)
+	}
+	return FromImage(img)
+}
+
+// FromImage 识别图片中的二维码点阵, 不解析二维码内容.
+// 图片中只能有一个未旋转的二维码, 中间的头像等图案会按原样采样
+func FromImage(img image.Image) (*Code, error) {
+	b := img.Bounds()
+	minX, minY, maxX, maxY := b.Max.X, b.Max.Y, b.Min.X-1, b.Min.Y-1
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if isDark(img, x, y) {
+				minX, minY = min(minX, x), min(minY, y)
+				maxX, maxY = max(maxX, x), max(maxY, y)
+			}
+		}
+	}
+	if maxX < minX {
+		return nil, ErrNotFound
+	}
+	// 左上角定位图案的第一行是 7 个连续的深色模块
+	run := 0
+	for x := minX; x <= maxX && isDark(img, x, minY); x++ {
+		run++
+	}
+	width := float64(maxX - minX + 1)
+	module := float64(run) / 7
+	version := int(math.Round((width/module - 17) / 4))
+	if version < 1 || version > 40 {
+		return nil, ErrNotFound
+	}
+	n := version*4 + 17
+	step := width / float64(n)
+	if float64(maxY-minY+1) < width-step {
+		return nil, ErrNotFound
+	}
+	size := n + quietZone*2
+	bitmap := make([][]bool, size)
+	for i := range bitmap {
+		bitmap[i] = make([]bool, size)
+	}
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			px := minX + int((float64(x)+0.5)*step)
+			py := minY + int((float64(y)+0.5)*step)
+			bitmap[y+quietZone][x+quietZone] = isDark(img, px, py)
+		}
+	}
+	c := &Code{bitmap: bitmap}
+	for _, p := range [][2]int{{0, 0}, {n - 7, 0}, {0, n - 7}} {
+		if !c.isFinder(p[0]+quietZone, p[1]+quietZone) {
+			return nil, ErrNotFound
+		}
+	}
+	return c, nil
+}
+
+// isFinder 判断以 (x0, y0) 为左上角的 7x7 区域是否为定位图案
+func (c *Code) isFinder(x0, y0 int) bool {
+	for y := 0; y < 7; y++ {
+		for x := 0; x < 7; x++ {
+			ring := min(min(x, y), min(6-x, 6-y))
+			// 最外圈和中间 3x3 为深色, 其间一圈为浅色
+			if c.bitmap[y0+y][x0+x] != (ring != 1) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isDark 亮度低于一半且不透明的像素视为深色
+func isDark(img image.Image, x, y int) bool {
+	r, g, b, a := img.At(x, y).RGBA()
+	if a < 0x8000 {
+		return false
+	}
+	// 与 color.GrayModel 相同的亮度计算
+	lum := (19595*r + 38470*g + 7471*b + 1<<15) >> 16
+	return lum < 0x8000
+}
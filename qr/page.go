@@ -0,0 +1,153 @@
+package qr
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/tuotoo/padchat"
+)
+
+// pageTmpl 每秒查询一次状态, 二维码变化时重新加载图片
+var pageTmpl = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.}}</title>
+<style>
+body { font-family: sans-serif; text-align: center; margin-top: 40px; }
+img { width: 300px; height: 300px; }
+</style>
+</head>
+<body>
+<h1>{{.}}</h1>
+<img id="qr" alt="qr code" hidden>
+<p id="state">waiting for qr code</p>
+<script>
+var version = 0;
+function poll() {
+	fetch("state").then(function (r) { return r.json(); }).then(function (s) {
+		if (s.version !== version) {
+			version = s.version;
+			var img = document.getElementById("qr");
+			img.src = "qr.svg?v=" + version;
+			img.hidden = false;
+		}
+		document.getElementById("state").textContent = s.state;
+	}).catch(function () {}).then(function () {
+		setTimeout(poll, 1000);
+	});
+}
+poll();
+</script>
+</body>
+</html>
+`))
+
+// pageState 页面查询的状态
+type pageState struct {
+	// Version 每次更换二维码时加一, 为 0 时还没有二维码
+	Version int    `json:"version"`
+	State   string `json:"state"`
+}
+
+// Page 显示二维码和扫码状态的 HTTP 页面, 实现 padchat.QRSink 和 http.Handler,
+// 收到新的二维码或扫码状态变化时页面自动刷新, 用于在无法查看终端的环境中登录.
+// 挂载到子路径时需以 `/` 结尾, 如 mux.Handle("/login/", http.StripPrefix("/login", page))
+type Page struct {
+	// Title 页面标题
+	Title string
+
+	mu    sync.RWMutex
+	code  *Code
+	state pageState
+}
+
+// NewPage 新建页面
+func NewPage() *Page {
+	return &Page{Title: "WeChat Login"}
+}
+
+// QRCode 实现 padchat.QRSink
+func (p *Page) QRCode(url string) {
+	code, err := New(url)
+	if err != nil {
+		p.setState("render qr code failed: " + err.Error())
+		return
+	}
+	p.Set(code, padchat.ScanWaiting.String())
+}
+
+// Scan 实现 padchat.QRSink
+func (p *Page) Scan(scan padchat.ScanResp) {
+	state := scan.State().String()
+	if scan.NickName != "" {
+		state += " (" + scan.NickName + ")"
+	}
+	p.setState(state)
+}
+
+// Set 显示 code, 如 FromBase64 识别的群二维码, state 为显示在二维码下方的文字
+func (p *Page) Set(code *Code, state string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.code = code
+	p.state.Version++
+	p.state.State = state
+}
+
+func (p *Page) setState(state string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.State = state
+}
+
+// Attach 使用 bot 的 OnQRURL 和 OnScan 回调更新页面, 用于不通过 LoginWithQR 登录的情况
+func (p *Page) Attach(bot *padchat.Bot) (detach func()) {
+	unQR := bot.OnQRURL(p.QRCode)
+	unScan := bot.OnScan(p.Scan)
+	return func() {
+		unQR()
+		unScan()
+	}
+}
+
+// ServeHTTP 实现 http.Handler, 提供页面, /qr.png, /qr.svg 和 /state
+func (p *Page) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.RLock()
+	code, state := p.code, p.state
+	p.mu.RUnlock()
+	w.Header().Set("Cache-Control", "no-store")
+	switch strings.TrimPrefix(r.URL.Path, "/") {
+	case "":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		pageTmpl.Execute(w, p.Title)
+	case "state":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(state)
+	case "qr.svg":
+		if code == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write(code.SVG(0))
+	case "qr.png":
+		if code == nil {
+			http.NotFound(w, r)
+			return
+		}
+		data, err := code.PNG(8)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(data)
+	default:
+		http.NotFound(w, r)
+	}
+}
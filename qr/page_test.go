@@ -0,0 +1,58 @@
+package qr_test
+
+import (
+	"encoding/json"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuotoo/padchat"
+	"github.com/tuotoo/padchat/qr"
+)
+
+func TestPage(t *testing.T) {
+	page := qr.NewPage()
+	page.Title = "Bot Login"
+	s := httptest.NewServer(http.StripPrefix("/login", page))
+	defer s.Close()
+
+	get := func(path string) *http.Response {
+		resp, err := http.Get(s.URL + "/login" + path)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	state := func() (v struct {
+		Version int
+		State   string
+	}) {
+		require.NoError(t, json.NewDecoder(get("/state").Body).Decode(&v))
+		return v
+	}
+
+	body, err := io.ReadAll(get("/").Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "<title>Bot Login</title>")
+	assert.Equal(t, http.StatusNotFound, get("/qr.svg").StatusCode)
+	assert.Equal(t, 0, state().Version)
+
+	page.QRCode(loginURL)
+	s1 := state()
+	assert.Equal(t, 1, s1.Version)
+	assert.Equal(t, "waiting", s1.State)
+	page.Scan(padchat.ScanResp{Status: 1, NickName: "Alice"})
+	assert.Equal(t, "scanned (Alice)", state().State)
+	page.QRCode(loginURL + "2")
+	assert.Equal(t, 2, state().Version)
+
+	resp := get("/qr.svg")
+	assert.Equal(t, "image/svg+xml", resp.Header.Get("Content-Type"))
+	_, err = png.Decode(get("/qr.png").Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, get("/other").StatusCode)
+}
@@ -0,0 +1,134 @@
+// Package qr 将二维码渲染为终端字符, PNG, SVG 或自动刷新的本地 HTTP 页面
+//
+// 登录二维码可通过 New 根据 OnQRURL 收到的内容生成, GetRoomQRCode 和 GetUserQRCode
+// 返回的 base64 图片可通过 FromBase64 识别后同样渲染.
+// Terminal 和 Page 实现了 padchat.QRSink, 可直接用于 Bot.LoginWithQR.
+package qr
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// quietZone 二维码四周空白的宽度, 单位为模块
+const quietZone = 4
+
+// Code 二维码的点阵
+type Code struct {
+	// Content 二维码内容, 从图片识别的二维码为空
+	Content string
+	bitmap  [][]bool
+}
+
+// New 将 content 编码为二维码
+func New(content string) (*Code, error) {
+	q, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return nil, fmt.Errorf("qr: encode: %w", err)
+	}
+	return &Code{Content: content, bitmap: q.Bitmap()}, nil
+}
+
+// Size 返回每边的模块数量, 包括四周空白
+func (c *Code) Size() int {
+	return len(c.bitmap)
+}
+
+// Bitmap 返回二维码点阵, true 为深色模块, 包括四周空白
+func (c *Code) Bitmap() [][]bool {
+	bitmap := make([][]bool, len(c.bitmap))
+	for i, row := range c.bitmap {
+		bitmap[i] = append([]bool(nil), row...)
+	}
+	return bitmap
+}
+
+// Terminal 返回用于终端显示的字符, 每个字符表示上下两个模块,
+// 使用 ANSI 颜色固定为白底黑码, 在深色背景的终端中同样可以扫描
+func (c *Code) Terminal() string {
+	var b strings.Builder
+	for y := 0; y < len(c.bitmap); y += 2 {
+		b.WriteString("\033[30;47m")
+		for x := range c.bitmap[y] {
+			top := c.bitmap[y][x]
+			bottom := y+1 < len(c.bitmap) && c.bitmap[y+1][x]
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\033[0m\n")
+	}
+	return b.String()
+}
+
+// Image 返回二维码图片, scale 为每个模块的像素数, 小于 1 时为 1
+func (c *Code) Image(scale int) image.Image {
+	if scale < 1 {
+		scale = 1
+	}
+	n := len(c.bitmap)
+	img := image.NewPaletted(image.Rect(0, 0, n*scale, n*scale), color.Palette{color.White, color.Black})
+	for y, row := range c.bitmap {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex(x*scale+dx, y*scale+dy, 1)
+				}
+			}
+		}
+	}
+	return img
+}
+
+// PNG 返回 PNG 格式的二维码图片, scale 为每个模块的像素数
+func (c *Code) PNG(scale int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, c.Image(scale)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG 返回 SVG 格式的二维码图片, size 为宽高的像素数, 小于 1 时与模块数相同
+func (c *Code) SVG(size int) []byte {
+	n := len(c.bitmap)
+	if size < 1 {
+		size = n
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, n, n)
+	b.WriteString(`<rect width="100%" height="100%" fill="#fff"/><path fill="#000" d="`)
+	for y, row := range c.bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			// 合并同一行中相邻的深色模块
+			w := 1
+			for x+w < len(row) && row[x+w] {
+				w++
+			}
+			fmt.Fprintf(&b, "M%d %dh%dv1h-%dz", x, y, w, w)
+			x += w - 1
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return b.Bytes()
+}
@@ -0,0 +1,82 @@
+package qr_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuotoo/padchat"
+	"github.com/tuotoo/padchat/qr"
+)
+
+const loginURL = "http://weixin.qq.com/x/IbK9l2gSdQ1tVn0tq0bN"
+
+func TestCode(t *testing.T) {
+	code, err := qr.New(loginURL)
+	require.NoError(t, err)
+	assert.Equal(t, loginURL, code.Content)
+	n := code.Size()
+
+	lines := strings.Split(strings.TrimSuffix(code.Terminal(), "\n"), "\n")
+	assert.Len(t, lines, (n+1)/2)
+
+	svg := string(code.SVG(300))
+	assert.True(t, strings.HasPrefix(svg, "<svg"))
+	assert.Contains(t, svg, `width="300"`)
+
+	data, err := code.PNG(3)
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, n*3, img.Bounds().Dx())
+}
+
+func TestFromBase64(t *testing.T) {
+	code, err := qr.New(loginURL)
+	require.NoError(t, err)
+
+	data, err := code.PNG(4)
+	require.NoError(t, err)
+	got, err := qr.FromBase64("data:image/png;base64," + base64.StdEncoding.EncodeToString(data))
+	require.NoError(t, err)
+	assert.Equal(t, code.Bitmap(), got.Bitmap())
+
+	// 二维码不在图片中央, 且经过有损压缩
+	canvas := image.NewRGBA(image.Rect(0, 0, 400, 460))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	qrImg := code.Image(7)
+	draw.Draw(canvas, qrImg.Bounds().Add(image.Pt(13, 21)), qrImg, image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, canvas, &jpeg.Options{Quality: 80}))
+	got, err = qr.FromBase64(base64.StdEncoding.EncodeToString(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, code.Bitmap(), got.Bitmap())
+
+	buf.Reset()
+	require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, 50, 50))))
+	_, err = qr.FromBase64(base64.StdEncoding.EncodeToString(buf.Bytes()))
+	assert.True(t, errors.Is(err, qr.ErrNotFound), "%v", err)
+	_, err = qr.FromBase64("not base64")
+	assert.Error(t, err)
+}
+
+func TestTerminal(t *testing.T) {
+	var buf bytes.Buffer
+	term := qr.NewTerminal(&buf)
+	term.QRCode(loginURL)
+	term.Scan(padchat.ScanResp{Status: 1, NickName: "Alice"})
+	out := buf.String()
+	assert.Contains(t, out, "\033[30;47m")
+	assert.Contains(t, out, loginURL+"\n")
+	assert.True(t, strings.HasSuffix(out, "scan: scanned (Alice)\n"))
+}
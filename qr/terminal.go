@@ -0,0 +1,42 @@
+package qr
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tuotoo/padchat"
+)
+
+// Terminal 在终端中显示登录二维码和扫码状态, 实现 padchat.QRSink
+type Terminal struct {
+	w io.Writer
+}
+
+// NewTerminal 新建输出到 w 的 Terminal, w 为 nil 时输出到 os.Stdout
+func NewTerminal(w io.Writer) *Terminal {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &Terminal{w: w}
+}
+
+// QRCode 实现 padchat.QRSink
+func (t *Terminal) QRCode(url string) {
+	code, err := New(url)
+	if err != nil {
+		fmt.Fprintf(t.w, "render qr code failed: %v\n%s\n", err, url)
+		return
+	}
+	fmt.Fprint(t.w, code.Terminal())
+	fmt.Fprintln(t.w, url)
+}
+
+// Scan 实现 padchat.QRSink
+func (t *Terminal) Scan(scan padchat.ScanResp) {
+	if scan.NickName != "" {
+		fmt.Fprintf(t.w, "scan: %s (%s)\n", scan.State(), scan.NickName)
+		return
+	}
+	fmt.Fprintf(t.w, "scan: %s\n", scan.State())
+}
@@ -0,0 +1,87 @@
+package padchat
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket 令牌桶, 每 interval 补充一个令牌, 最多保存 burst 个
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter 按 key 分别限流的令牌桶集合
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    int
+	buckets  map[string]*tokenBucket
+}
+
+func newRateLimiter(interval time.Duration, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		interval: interval,
+		burst:    burst,
+		buckets:  make(map[string]*tokenBucket),
+	}
+}
+
+// allow 有可用令牌时取出并返回 true, 否则返回 false 且不消耗令牌
+func (l *rateLimiter) allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.refill(key, now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// refill 按经过的时间补充令牌, 并清理已补满的其他桶
+func (l *rateLimiter) refill(key string, now time.Time) *tokenBucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= 1024 {
+			l.gc(now)
+		}
+		b = &tokenBucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+		return b
+	}
+	if l.interval > 0 {
+		b.tokens += float64(now.Sub(b.last)) / float64(l.interval)
+	} else {
+		b.tokens = float64(l.burst)
+	}
+	if b.tokens > float64(l.burst) {
+		b.tokens = float64(l.burst)
+	}
+	b.last = now
+	return b
+}
+
+// gc 删除已补满的桶, 这些桶与新建的桶等价
+func (l *rateLimiter) gc(now time.Time) {
+	full := time.Duration(l.burst) * l.interval
+	for k, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// delay 返回距离有可用令牌的时间, 有可用令牌时为 0, 不消耗令牌
+func (l *rateLimiter) delay(key string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.refill(key, now)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) * float64(l.interval))
+}
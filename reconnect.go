@@ -0,0 +1,215 @@
+package padchat
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ReconnectPolicy 断线重连策略
+type ReconnectPolicy struct {
+	// MinBackoff 首次重连前的等待时间, 之后每次失败翻倍, 为 0 时使用 DefaultReconnectPolicy 的值
+	MinBackoff time.Duration
+	// MaxBackoff 重连等待时间上限, 为 0 时使用 DefaultReconnectPolicy 的值
+	MaxBackoff time.Duration
+	// MaxRetries 最大重连次数, 0 为不限制
+	MaxRetries int
+	// ReLogin 重连后使用缓存的 wxData 和 token 自动登录,
+	// 先尝试 TokenLogin, 失败后使用 RequestLogin
+	ReLogin bool
+}
+
+// DefaultReconnectPolicy 默认断线重连策略
+var DefaultReconnectPolicy = ReconnectPolicy{
+	MinBackoff: time.Second,
+	MaxBackoff: time.Minute,
+	ReLogin:    true,
+}
+
+// withDefaults 使用 DefaultReconnectPolicy 填充为 0 的等待时间, 避免不等待直接重连
+func (p ReconnectPolicy) withDefaults() ReconnectPolicy {
+	if p.MinBackoff <= 0 {
+		p.MinBackoff = DefaultReconnectPolicy.MinBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultReconnectPolicy.MaxBackoff
+	}
+	if p.MaxBackoff < p.MinBackoff {
+		p.MaxBackoff = p.MinBackoff
+	}
+	return p
+}
+
+// nextBackoff 返回 backoff 翻倍后的等待时间, 不超过 MaxBackoff
+func (p ReconnectPolicy) nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return backoff
+}
+
+// errNoSession 没有可用于重新登录的缓存数据
+var errNoSession = errors.New("no cached wxData or token")
+
+// loginSession 缓存的登录数据, 用于断线重连后重新登录
+type loginSession struct {
+	sync.Mutex
+	wxData string
+	token  string
+}
+
+func (s *loginSession) setWXData(wxData string) {
+	s.Lock()
+	defer s.Unlock()
+	s.wxData = wxData
+}
+
+func (s *loginSession) setToken(token string) {
+	s.Lock()
+	defer s.Unlock()
+	s.token = token
+}
+
+func (s *loginSession) set(wxData, token string) {
+	s.Lock()
+	defer s.Unlock()
+	s.wxData = wxData
+	s.token = token
+}
+
+func (s *loginSession) get() (wxData, token string) {
+	s.Lock()
+	defer s.Unlock()
+	return s.wxData, s.token
+}
+
+// SetReconnect 设置断线重连策略, 传入 nil 关闭断线重连, 默认关闭
+func (bot *Bot) SetReconnect(p *ReconnectPolicy) {
+	bot.connMu.Lock()
+	defer bot.connMu.Unlock()
+	bot.reconnect = p
+}
+
+// reconnectPolicy 返回当前的断线重连策略, 未开启时返回零值
+func (bot *Bot) reconnectPolicy() ReconnectPolicy {
+	bot.connMu.RLock()
+	defer bot.connMu.RUnlock()
+	if bot.reconnect == nil {
+		return ReconnectPolicy{}
+	}
+	return *bot.reconnect
+}
+
+// markClosed 标记连接为主动关闭, 不再触发重连, 并使等待中的指令返回 ErrConnClosed
+// 返回当前连接
+func (bot *Bot) markClosed() *WSConn {
+	bot.connMu.Lock()
+	defer bot.connMu.Unlock()
+	if !bot.closed {
+		bot.closed = true
+		close(bot.done)
+	}
+	return bot.ws
+}
+
+// isClosed 连接是否已主动关闭
+func (bot *Bot) isClosed() bool {
+	bot.connMu.RLock()
+	defer bot.connMu.RUnlock()
+	return bot.closed
+}
+
+// handleDisconnect 处理读取失败, ws 为读取失败的连接
+func (bot *Bot) handleDisconnect(ws *WSConn, err error) {
+	bot.connMu.RLock()
+	stale := bot.closed || bot.ws != ws
+	enabled := bot.reconnect != nil
+	bot.connMu.RUnlock()
+	if stale {
+		return
+	}
+	bot.setState(StateDisconnected)
+	ws.Close()
+	bot.logger.Warn("disconnected", "error", err)
+	bot.watch(DisconnectEvent{Err: err})
+	bot.notify(DisconnectEvent{Err: err})
+	if enabled {
+		go bot.redial()
+	}
+}
+
+// redial 按重连策略重新连接服务端, 成功后恢复登录状态
+func (bot *Bot) redial() {
+	p := bot.reconnectPolicy().withDefaults()
+	backoff := p.MinBackoff
+	for i := 0; p.MaxRetries == 0 || i < p.MaxRetries; i++ {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-bot.done:
+			timer.Stop()
+			return
+		}
+		backoff = p.nextBackoff(backoff)
+		bot.setState(StateConnecting)
+		conn, err := bot.dial()
+		if err != nil {
+			bot.logger.Warn("reconnect failed", "attempt", i+1, "error", err)
+			continue
+		}
+		if err := bot.attach(conn); err == ErrConnClosed {
+			return
+		} else if err != nil {
+			bot.logger.Warn("reconnect failed", "attempt", i+1, "error", err)
+			continue
+		}
+		if p.ReLogin {
+			if err := bot.resumeSession(); err != nil {
+				bot.logger.Warn("resume session failed", "error", err)
+			}
+		}
+		bot.logger.Info("reconnected", "attempt", i+1)
+		bot.notify(ReconnectEvent{})
+		return
+	}
+	bot.logger.Error("reconnect gave up", "retries", p.MaxRetries)
+	bot.setState(StateDisconnected)
+}
+
+// refreshSession 登录成功后缓存 wxData 和 token, 设置了 SessionStore 时一并保存
+func (bot *Bot) refreshSession() {
+	wxData, err := bot.GetWXData()
+	if err != nil {
+		bot.logger.Warn("cache wxData failed", "error", err)
+		return
+	}
+	token, err := bot.GetLoginToken()
+	if err != nil {
+		bot.logger.Warn("cache login token failed", "error", err)
+		return
+	}
+	store := bot.getSessionStore()
+	if store == nil {
+		return
+	}
+	err = store.Save(&Session{WXData: wxData, Token: token.Token, Uin: token.Uin})
+	if err != nil {
+		bot.logger.Warn("save session failed", "error", err)
+	}
+}
+
+// resumeSession 使用缓存的 wxData 和 token 重新登录
+func (bot *Bot) resumeSession() error {
+	wxData, token := bot.session.get()
+	if wxData == "" || token == "" {
+		return errNoSession
+	}
+	ctx := context.Background()
+	if _, err := bot.TokenLoginCtx(ctx, wxData, token); err == nil {
+		return nil
+	}
+	_, err := bot.RequestLoginCtx(ctx, wxData, token)
+	return err
+}
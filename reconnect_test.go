@@ -0,0 +1,26 @@
+package padchat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconnectBackoff(t *testing.T) {
+	p := ReconnectPolicy{}.withDefaults()
+	assert.Equal(t, DefaultReconnectPolicy.MinBackoff, p.MinBackoff)
+	assert.Equal(t, DefaultReconnectPolicy.MaxBackoff, p.MaxBackoff)
+
+	// 只设置 MinBackoff 时等待时间不会变为 0
+	p = ReconnectPolicy{MinBackoff: 10 * time.Millisecond}.withDefaults()
+	backoff := p.MinBackoff
+	for i := 0; i < 20; i++ {
+		backoff = p.nextBackoff(backoff)
+		assert.True(t, backoff >= p.MinBackoff && backoff <= p.MaxBackoff, "%v", backoff)
+	}
+	assert.Equal(t, DefaultReconnectPolicy.MaxBackoff, backoff)
+
+	p = ReconnectPolicy{MinBackoff: time.Hour}.withDefaults()
+	assert.Equal(t, time.Hour, p.nextBackoff(p.MinBackoff))
+}
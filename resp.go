@@ -51,6 +51,7 @@ type CommandResp struct {
 	Success bool
 	Data    json.RawMessage
 	Msg     string
+	cmdID   string
 }
 
 type LoginTokenResp struct {
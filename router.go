@@ -0,0 +1,333 @@
+package padchat
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MsgContext 路由处理消息时的上下文
+type MsgContext struct {
+	// Ctx 调用指令时使用的 context
+	Ctx context.Context
+	Bot *Bot
+	Msg Msg
+	// SelfID Bot 自身的微信 ID, 登录后尚未获取时为空
+	SelfID string
+	// Text 文本消息的内容, 已去除群消息的发送者前缀
+	Text string
+	// Args 命令参数, 由 MatchCommand 设置, 只保留执行的路由中的值
+	Args string
+	// Matches 正则匹配结果, 由 MatchRegexp 设置, 只保留执行的路由中的值
+	Matches []string
+	values  map[string]interface{}
+}
+
+// ChatID 返回回复消息时的目标 ID, 群消息为群 ID, 否则为发送者 ID
+func (c *MsgContext) ChatID() string {
+	if id := c.Msg.GroupID(); id != "" {
+		return id
+	}
+	if c.Msg.FromUser == c.SelfID {
+		return c.Msg.ToUser
+	}
+	return c.Msg.FromUser
+}
+
+// Reply 向消息所在会话发送文本消息
+func (c *MsgContext) Reply(text string) (*SendMsgResp, error) {
+	return c.Bot.SendMsgCtx(c.Ctx, &SendMsgReq{
+		ToUserName: c.ChatID(),
+		Content:    text,
+	})
+}
+
+// ReplyAt 向消息所在会话发送文本消息, 群消息中会 @ 发送者
+func (c *MsgContext) ReplyAt(text string) (*SendMsgResp, error) {
+	req := &SendMsgReq{
+		ToUserName: c.ChatID(),
+		Content:    text,
+	}
+	if c.Msg.IsGroup() {
+		req.AtList = []string{c.Msg.SenderID()}
+	}
+	return c.Bot.SendMsgCtx(c.Ctx, req)
+}
+
+// ReplyImage 向消息所在会话发送图片, file 为图片 base64 数据
+func (c *MsgContext) ReplyImage(file string) (*SendMsgResp, error) {
+	return c.Bot.SendImageCtx(c.Ctx, SendMsgReq{
+		ToUserName: c.ChatID(),
+		File:       file,
+	})
+}
+
+// Parse 解析消息, 同 ParseMsg
+func (c *MsgContext) Parse() (Message, error) {
+	return ParseMsg(c.Msg)
+}
+
+// Set 保存数据, 用于在中间件和处理函数之间传递
+func (c *MsgContext) Set(key string, v interface{}) {
+	if c.values == nil {
+		c.values = make(map[string]interface{})
+	}
+	c.values[key] = v
+}
+
+// Get 获取 Set 保存的数据
+func (c *MsgContext) Get(key string) (interface{}, bool) {
+	v, ok := c.values[key]
+	return v, ok
+}
+
+// HandlerFunc 消息处理函数
+type HandlerFunc func(c *MsgContext)
+
+// Middleware 中间件, 包装消息处理函数
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Matcher 消息匹配条件
+type Matcher func(c *MsgContext) bool
+
+type route struct {
+	matchers []Matcher
+	handler  HandlerFunc
+}
+
+// Router 消息路由, 按注册顺序匹配, 只执行第一个匹配的处理函数
+type Router struct {
+	mu          sync.RWMutex
+	bot         *Bot
+	selfID      string
+	routes      []route
+	middlewares []Middleware
+	notFound    HandlerFunc
+}
+
+// NewRouter 新建消息路由并注册到 bot 的 OnMsg 回调,
+// 每次登录后通过 GetMyInfo 获取一次 Bot 自身的微信 ID
+func NewRouter(bot *Bot) *Router {
+	r := &Router{bot: bot}
+	bot.OnMsg(r.Dispatch)
+	bot.OnLogin(r.loadSelfID)
+	if bot.isLoggedIn() {
+		go r.loadSelfID()
+	}
+	return r
+}
+
+// SetSelfID 设置 Bot 自身的微信 ID, 未设置时在登录后通过 GetMyInfo 获取
+func (r *Router) SetSelfID(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.selfID = id
+}
+
+// Use 添加中间件, 按添加顺序由外到内执行
+func (r *Router) Use(mw ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middlewares = append(r.middlewares, mw...)
+}
+
+// Handle 注册处理函数, 所有条件均满足时执行
+func (r *Router) Handle(h HandlerFunc, matchers ...Matcher) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes = append(r.routes, route{matchers: matchers, handler: h})
+}
+
+// Type 按消息类型注册处理函数
+func (r *Router) Type(mType int, h HandlerFunc, matchers ...Matcher) {
+	r.Handle(h, append([]Matcher{MatchType(mType)}, matchers...)...)
+}
+
+// Text 按文本完全匹配注册处理函数
+func (r *Router) Text(text string, h HandlerFunc, matchers ...Matcher) {
+	r.Handle(h, append([]Matcher{MatchText(text)}, matchers...)...)
+}
+
+// Prefix 按文本前缀注册处理函数
+func (r *Router) Prefix(prefix string, h HandlerFunc, matchers ...Matcher) {
+	r.Handle(h, append([]Matcher{MatchPrefix(prefix)}, matchers...)...)
+}
+
+// Regexp 按正则表达式注册处理函数, 匹配结果保存在 MsgContext.Matches 中
+func (r *Router) Regexp(re *regexp.Regexp, h HandlerFunc, matchers ...Matcher) {
+	r.Handle(h, append([]Matcher{MatchRegexp(re)}, matchers...)...)
+}
+
+// Command 注册命令处理函数, 如 Command("/help", h), 参数保存在 MsgContext.Args 中
+func (r *Router) Command(name string, h HandlerFunc, matchers ...Matcher) {
+	r.Handle(h, append([]Matcher{MatchCommand(name)}, matchers...)...)
+}
+
+// NotFound 设置没有匹配的处理函数时执行的函数
+func (r *Router) NotFound(h HandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notFound = h
+}
+
+// Dispatch 将消息交给第一个匹配的处理函数
+func (r *Router) Dispatch(msg Msg) {
+	c := &MsgContext{
+		Ctx:    context.Background(),
+		Bot:    r.bot,
+		Msg:    msg,
+		SelfID: r.getSelfID(),
+	}
+	if msg.MType == MsgTypeText {
+		c.Text = msg.Body()
+	}
+	r.mu.RLock()
+	routes := r.routes
+	middlewares := r.middlewares
+	h := r.notFound
+	r.mu.RUnlock()
+	for _, rt := range routes {
+		if matchAll(c, rt.matchers) {
+			h = rt.handler
+			break
+		}
+	}
+	if h == nil {
+		return
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	h(c)
+}
+
+// loadSelfID 通过 GetMyInfo 获取 Bot 自身的微信 ID, 失败时保留原来的值
+func (r *Router) loadSelfID() {
+	info, err := r.bot.GetMyInfo()
+	if err != nil || info.UserName == "" {
+		r.bot.logger.Warn("router get self id failed", "error", err)
+		return
+	}
+	r.SetSelfID(info.UserName)
+}
+
+// getSelfID 返回 Bot 自身的微信 ID, 尚未获取时返回空
+func (r *Router) getSelfID() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.selfID
+}
+
+// matchAll 是否满足所有条件, 不满足时恢复 Matcher 设置的 Args 和 Matches
+func matchAll(c *MsgContext, matchers []Matcher) bool {
+	args, matches := c.Args, c.Matches
+	for _, m := range matchers {
+		if !m(c) {
+			c.Args, c.Matches = args, matches
+			return false
+		}
+	}
+	return true
+}
+
+// MatchType 匹配消息类型
+func MatchType(mType int) Matcher {
+	return func(c *MsgContext) bool {
+		return c.Msg.MType == mType
+	}
+}
+
+// MatchText 匹配与 text 完全相同的文本消息, 忽略开头的 @
+func MatchText(text string) Matcher {
+	return func(c *MsgContext) bool {
+		return trimMentions(c.Text) == text
+	}
+}
+
+// MatchPrefix 匹配以 prefix 开头的文本消息, 忽略开头的 @
+func MatchPrefix(prefix string) Matcher {
+	return func(c *MsgContext) bool {
+		return strings.HasPrefix(trimMentions(c.Text), prefix)
+	}
+}
+
+// MatchRegexp 匹配符合正则表达式的文本消息, 忽略开头的 @
+func MatchRegexp(re *regexp.Regexp) Matcher {
+	return func(c *MsgContext) bool {
+		m := re.FindStringSubmatch(trimMentions(c.Text))
+		if m == nil {
+			return false
+		}
+		c.Matches = m
+		return true
+	}
+}
+
+// MatchCommand 匹配命令, 如 "/help" 匹配 "/help" 和 "/help xxx", 忽略开头的 @
+func MatchCommand(name string) Matcher {
+	return func(c *MsgContext) bool {
+		text := trimMentions(c.Text)
+		if text != name && !strings.HasPrefix(text, name+" ") {
+			return false
+		}
+		c.Args = strings.TrimSpace(strings.TrimPrefix(text, name))
+		return true
+	}
+}
+
+// FromSender 匹配指定发送者的消息
+func FromSender(ids ...string) Matcher {
+	return func(c *MsgContext) bool {
+		return containsString(ids, c.Msg.SenderID())
+	}
+}
+
+// InGroup 匹配指定群的消息, 不传入 ID 时匹配所有群消息
+func InGroup(ids ...string) Matcher {
+	return func(c *MsgContext) bool {
+		id := c.Msg.GroupID()
+		if len(ids) == 0 {
+			return id != ""
+		}
+		return containsString(ids, id)
+	}
+}
+
+// Private 匹配非群消息
+func Private() Matcher {
+	return func(c *MsgContext) bool {
+		return !c.Msg.IsGroup()
+	}
+}
+
+// MentionedMe 匹配 @ 了 Bot 的群消息
+func MentionedMe() Matcher {
+	return func(c *MsgContext) bool {
+		return c.SelfID != "" && c.Msg.MentionsMe(c.SelfID)
+	}
+}
+
+// trimMentions 去除文本开头的 @xxx, 微信使用 U+2005 空格分隔 @ 和正文
+func trimMentions(text string) string {
+	for strings.HasPrefix(text, "@") {
+		i := strings.IndexFunc(text, unicode.IsSpace)
+		if i < 0 {
+			return text
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		text = strings.TrimLeftFunc(text[i+size:], unicode.IsSpace)
+	}
+	return text
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
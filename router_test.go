@@ -0,0 +1,161 @@
+package padchat_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuotoo/padchat"
+)
+
+func TestRouter(t *testing.T) {
+	bot, s := newTestBot(t)
+	login(t, bot)
+	r := padchat.NewRouter(bot)
+	r.SetSelfID("wxid_bot")
+
+	var got []string
+	r.Use(func(next padchat.HandlerFunc) padchat.HandlerFunc {
+		return func(c *padchat.MsgContext) {
+			got = append(got, "mw")
+			next(c)
+		}
+	})
+	r.Command("/help", func(c *padchat.MsgContext) {
+		got = append(got, "help:"+c.Args)
+	})
+	r.Text("ping", func(c *padchat.MsgContext) {
+		got = append(got, "ping")
+		_, err := c.ReplyAt("pong")
+		assert.NoError(t, err)
+	}, padchat.InGroup())
+	r.Regexp(regexp.MustCompile(`^add (\d+) (\d+)$`), func(c *padchat.MsgContext) {
+		got = append(got, "add:"+c.Matches[1]+c.Matches[2])
+	})
+	r.Type(padchat.MsgTypeImage, func(c *padchat.MsgContext) {
+		got = append(got, "image")
+	})
+	r.Handle(func(c *padchat.MsgContext) {
+		got = append(got, "mention")
+	}, padchat.MentionedMe())
+	r.NotFound(func(c *padchat.MsgContext) {
+		got = append(got, "notfound")
+	})
+
+	r.Dispatch(newMsg(padchat.MsgTypeText, "/help me"))
+	r.Dispatch(newMsg(padchat.MsgTypeText, "/helpme"))
+	r.Dispatch(newMsg(padchat.MsgTypeText, "add 1 2"))
+	r.Dispatch(newMsg(padchat.MsgTypeImage, "<msg><img /></msg>"))
+	r.Dispatch(newMsg(padchat.MsgTypeText, "ping"))
+
+	group := newMsg(padchat.MsgTypeText, "wxid_b:\n@bot\u2005ping")
+	group.FromUser = "123@chatroom"
+	group.MsgSource = `<msgsource><atuserlist>wxid_bot</atuserlist></msgsource>`
+	r.Dispatch(group)
+	group = newMsg(padchat.MsgTypeText, "wxid_b:\n@bot\u2005hi")
+	group.FromUser = "123@chatroom"
+	group.MsgSource = `<msgsource><atuserlist>wxid_bot</atuserlist></msgsource>`
+	r.Dispatch(group)
+
+	assert.Equal(t, []string{
+		"mw", "help:me",
+		"mw", "notfound",
+		"mw", "add:12",
+		"mw", "image",
+		"mw", "notfound",
+		"mw", "ping",
+		"mw", "mention",
+	}, got)
+
+	req, ok := s.WaitRequest("sendMsg", time.Second)
+	require.True(t, ok)
+	var sent padchat.SendMsgReq
+	require.NoError(t, req.Bind(&sent))
+	assert.Equal(t, "123@chatroom", sent.ToUserName)
+	assert.Contains(t, sent.Content, "pong")
+	assert.Equal(t, []string{"wxid_b"}, sent.AtList)
+}
+
+func TestMiddleware(t *testing.T) {
+	r := padchat.NewRouter(&padchat.Bot{})
+	r.SetSelfID("wxid_bot")
+	var handled, limited, denied int
+	r.Use(
+		padchat.Recover(padchat.NopLogger),
+		padchat.Auth(padchat.FromSender("wxid_a", "wxid_b"), func(*padchat.MsgContext) { denied++ }),
+		padchat.RateLimit(time.Hour, 2, func(*padchat.MsgContext) { limited++ }),
+	)
+	r.Text("panic", func(*padchat.MsgContext) { panic("boom") })
+	r.NotFound(func(*padchat.MsgContext) { handled++ })
+
+	for i := 0; i < 3; i++ {
+		r.Dispatch(newMsg(padchat.MsgTypeText, "hi"))
+	}
+	msg := newMsg(padchat.MsgTypeText, "hi")
+	msg.FromUser = "wxid_c"
+	r.Dispatch(msg)
+	msg = newMsg(padchat.MsgTypeText, "panic")
+	msg.FromUser = "wxid_b"
+	assert.NotPanics(t, func() { r.Dispatch(msg) })
+	assert.Equal(t, 2, handled)
+	assert.Equal(t, 1, limited)
+	assert.Equal(t, 1, denied)
+}
+
+func TestRouterSelfID(t *testing.T) {
+	bot, s := newTestBot(t)
+	s.Reply("getMyInfo", padchat.MyInfoResp{UserName: "wxid_me"})
+	r := padchat.NewRouter(bot)
+	ids := make(chan string, 10)
+	r.NotFound(func(c *padchat.MsgContext) { ids <- c.SelfID })
+
+	// 登录前不获取
+	r.Dispatch(newMsg(padchat.MsgTypeText, "hi"))
+	assert.Equal(t, "", <-ids)
+	assert.Len(t, s.Requests("getMyInfo"), 0)
+
+	// 登录后获取一次, 分发消息时不再发送指令
+	login(t, bot)
+	_, ok := s.WaitRequest("getMyInfo", time.Second)
+	require.True(t, ok)
+	deadline := time.Now().Add(time.Second)
+	for {
+		r.Dispatch(newMsg(padchat.MsgTypeText, "hi"))
+		if <-ids == "wxid_me" {
+			break
+		}
+		require.True(t, time.Now().Before(deadline), "self id not loaded")
+		time.Sleep(10 * time.Millisecond)
+	}
+	n := len(s.Requests("getMyInfo"))
+	for i := 0; i < 3; i++ {
+		r.Dispatch(newMsg(padchat.MsgTypeText, "hi"))
+		assert.Equal(t, "wxid_me", <-ids)
+	}
+	assert.Len(t, s.Requests("getMyInfo"), n)
+}
+
+func TestRouterMatchValues(t *testing.T) {
+	r := padchat.NewRouter(&padchat.Bot{})
+	var got []string
+	// 第一个路由的正则和命令匹配, 但发送者不匹配, 其设置的值不应保留
+	r.Regexp(regexp.MustCompile(`^/echo (\w+)$`), func(c *padchat.MsgContext) {
+		got = append(got, "first")
+	}, padchat.MatchCommand("/echo"), padchat.FromSender("wxid_admin"))
+	r.Prefix("/echo", func(c *padchat.MsgContext) {
+		got = append(got, "args:"+c.Args, "matches:"+strings.Join(c.Matches, ","))
+	})
+	r.Regexp(regexp.MustCompile(`^add (\d+)$`), func(c *padchat.MsgContext) {
+		got = append(got, "add:"+c.Matches[1])
+	})
+
+	r.Dispatch(newMsg(padchat.MsgTypeText, "/echo hi"))
+	group := newMsg(padchat.MsgTypeText, "wxid_b:\n@bot\u2005add 3")
+	group.FromUser = "123@chatroom"
+	r.Dispatch(group)
+	assert.Equal(t, []string{"args:", "matches:", "add:3"}, got)
+}
@@ -0,0 +1,175 @@
+package padchat
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Session 用于再次登录的凭据
+type Session struct {
+	// WXData 设备62数据, 通过 GetWXData 获取
+	WXData string `json:"wxData"`
+	// Token 二次登陆数据, 通过 GetLoginToken 获取
+	Token string `json:"token"`
+	Uin   int64  `json:"uin,omitempty"`
+}
+
+// SessionStore 登录凭据的存储, 通过 AutoLogin 使用
+type SessionStore interface {
+	// Load 读取保存的凭据, 没有保存过时返回 nil, nil
+	Load() (*Session, error)
+	// Save 保存凭据, 覆盖之前保存的凭据
+	Save(s *Session) error
+}
+
+// MemorySessionStore 内存中的登录凭据, 程序退出后失效
+type MemorySessionStore struct {
+	mu      sync.Mutex
+	session *Session
+}
+
+// NewMemorySessionStore 新建内存登录凭据存储
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{}
+}
+
+// Load 实现 SessionStore
+func (s *MemorySessionStore) Load() (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.session == nil {
+		return nil, nil
+	}
+	session := *s.session
+	return &session, nil
+}
+
+// Save 实现 SessionStore
+func (s *MemorySessionStore) Save(session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved := *session
+	s.session = &saved
+	return nil
+}
+
+// FileSessionStore 以 JSON 格式保存到文件的登录凭据
+type FileSessionStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileSessionStore 新建文件登录凭据存储, 文件不存在时会在第一次保存时创建
+func NewFileSessionStore(path string) *FileSessionStore {
+	return &FileSessionStore{path: path}
+}
+
+// Load 实现 SessionStore
+func (s *FileSessionStore) Load() (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	session := &Session{}
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Save 实现 SessionStore, 先写入临时文件再替换, 避免写入中断导致文件损坏
+func (s *FileSessionStore) Save(session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
+
+// LoginMethod 登录方式
+type LoginMethod string
+
+const (
+	// LoginByToken 使用 TokenLogin 登录
+	LoginByToken LoginMethod = "token"
+	// LoginByRequest 使用 RequestLogin 登录, 需在手机上确认
+	LoginByRequest LoginMethod = "request"
+	// LoginByQRCode 使用 QRLogin 登录, 需扫描二维码
+	LoginByQRCode LoginMethod = "qrcode"
+	// LoginByPassword 使用 UserLogin 账号密码登录
+	LoginByPassword LoginMethod = "user"
+	// LoginByPhone 使用 PhoneLogin 手机验证码登录
+	LoginByPhone LoginMethod = "phone"
+)
+
+// AutoLogin 使用保存的凭据自动登录, 依次尝试 TokenLogin, RequestLogin 和 QRLogin, 返回使用的登录方式.
+// TokenLogin 和 RequestLogin 会等待登录结果, 失败时尝试下一种方式;
+// QRLogin 只等待指令执行成功, 扫码结果以 OnLogin 回调为准.
+// 之后每次登录成功都会获取新的 wxData 和 token 保存到 store
+func (bot *Bot) AutoLogin(store SessionStore) (LoginMethod, error) {
+	return bot.AutoLoginCtx(context.Background(), store)
+}
+
+// AutoLoginCtx 同 AutoLogin, 可通过 ctx 取消或设置截止时间
+func (bot *Bot) AutoLoginCtx(ctx context.Context, store SessionStore) (LoginMethod, error) {
+	bot.connMu.Lock()
+	bot.sessionStore = store
+	bot.connMu.Unlock()
+	session, err := store.Load()
+	if err != nil {
+		bot.logger.Warn("load session failed", "error", err)
+	}
+	if session != nil && session.WXData != "" && session.Token != "" {
+		bot.session.set(session.WXData, session.Token)
+		_, err := bot.LoginWithToken(ctx, session.WXData, session.Token)
+		if err == nil {
+			return LoginByToken, nil
+		}
+		bot.logger.Info("token login failed", "error", err)
+		if ctx.Err() != nil || bot.isClosed() {
+			return "", err
+		}
+		_, err = bot.LoginWithRequest(ctx, session.WXData, session.Token)
+		if err == nil {
+			return LoginByRequest, nil
+		}
+		bot.logger.Info("request login failed", "error", err)
+		if ctx.Err() != nil || bot.isClosed() {
+			return "", err
+		}
+	}
+	if _, err := bot.QRLoginCtx(ctx); err != nil {
+		return "", err
+	}
+	return LoginByQRCode, nil
+}
+
+// getSessionStore 返回 AutoLogin 设置的凭据存储
+func (bot *Bot) getSessionStore() SessionStore {
+	bot.connMu.RLock()
+	defer bot.connMu.RUnlock()
+	return bot.sessionStore
+}
@@ -0,0 +1,73 @@
+package padchat_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuotoo/padchat"
+	"github.com/tuotoo/padchat/padchattest"
+)
+
+func TestFileSessionStore(t *testing.T) {
+	store := padchat.NewFileSessionStore(filepath.Join(t.TempDir(), "session.json"))
+	s, err := store.Load()
+	require.NoError(t, err)
+	assert.Nil(t, s)
+	require.NoError(t, store.Save(&padchat.Session{WXData: "62", Token: "t", Uin: 1}))
+	s, err = store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, &padchat.Session{WXData: "62", Token: "t", Uin: 1}, s)
+}
+
+func TestAutoLogin(t *testing.T) {
+	bot, s := newTestBot(t)
+	var loginTypes []string
+	tokenReply := padchattest.Fail("token expired")
+	s.Handle("login", func(req padchattest.Request) padchattest.Reply {
+		var data padchat.LoginReq
+		req.Bind(&data)
+		loginTypes = append(loginTypes, data.LoginType)
+		if data.LoginType == "token" {
+			return tokenReply
+		}
+		return padchattest.OK(nil, padchattest.LoginEvent())
+	})
+	s.Reply("getWxData", map[string]string{"wx_data": "62new"})
+	s.Reply("getLoginToken", padchat.LoginTokenResp{Token: "new", Uin: 1})
+
+	store := padchat.NewMemorySessionStore()
+	method, err := bot.AutoLogin(store)
+	require.NoError(t, err)
+	assert.Equal(t, padchat.LoginByQRCode, method)
+	assert.Equal(t, []string{"qrcode"}, loginTypes)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		saved, err := store.Load()
+		require.NoError(t, err)
+		if saved != nil {
+			assert.Equal(t, &padchat.Session{WXData: "62new", Token: "new", Uin: 1}, saved)
+			break
+		}
+		require.True(t, time.Now().Before(deadline), "session not saved")
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	loginTypes = nil
+	method, err = bot.AutoLogin(store)
+	require.NoError(t, err)
+	assert.Equal(t, padchat.LoginByRequest, method)
+	assert.Equal(t, []string{"token", "request"}, loginTypes)
+
+	// 指令执行成功但随后收到 warn 时同样尝试下一种方式
+	tokenReply = padchattest.OK(nil, padchattest.WarnEvent("token invalid"))
+	loginTypes = nil
+	method, err = bot.AutoLogin(store)
+	require.NoError(t, err)
+	assert.Equal(t, padchat.LoginByRequest, method)
+	assert.Equal(t, []string{"token", "request"}, loginTypes)
+}
@@ -0,0 +1,55 @@
+package padchat
+
+import (
+	"context"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// closeGracePeriod 发送关闭帧后等待服务端响应的时间
+const closeGracePeriod = time.Second
+
+// Shutdown 优雅关闭 Bot: 停止读取数据和断线重连, 使等待中的指令返回 ErrConnClosed,
+// 发送 ws 关闭帧, 并等待已分发的回调执行完毕.
+// 可重复调用, ctx 结束时直接返回 ctx.Err(), 关闭流程仍会在后台继续
+func (bot *Bot) Shutdown(ctx context.Context) error {
+	bot.shutdownOnce.Do(func() {
+		go bot.shutdown()
+	})
+	select {
+	case <-bot.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (bot *Bot) shutdown() {
+	defer close(bot.stopped)
+	ws := bot.markClosed()
+	bot.setState(StateDisconnected)
+	err := ws.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, "shutdown"),
+		time.Now().Add(closeGracePeriod))
+	if err != nil {
+		bot.logger.Debug("write close frame failed", "error", err)
+	}
+	loopsDone := make(chan struct{})
+	go func() {
+		bot.loops.Wait()
+		close(loopsDone)
+	}()
+	select {
+	case <-loopsDone:
+	case <-time.After(closeGracePeriod):
+	}
+	ws.Close()
+	<-loopsDone
+	close(bot.events)
+	bot.workers.Wait()
+	bot.delivery.close()
+	bot.handlers.Wait()
+	bot.closeEvents()
+	bot.logger.Info("shutdown")
+}
@@ -0,0 +1,59 @@
+package padchat
+
+// State Bot 的连接状态
+type State int
+
+const (
+	// StateConnecting 正在连接服务端
+	StateConnecting State = iota
+	// StateConnected 已连接服务端, 微信未登录
+	StateConnected
+	// StateLoggedIn 已连接服务端且微信已登录
+	StateLoggedIn
+	// StateDisconnected 连接已断开
+	StateDisconnected
+)
+
+func (s State) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateLoggedIn:
+		return "logged-in"
+	case StateDisconnected:
+		return "disconnected"
+	}
+	return "unknown"
+}
+
+// State 返回当前连接状态
+func (bot *Bot) State() State {
+	bot.connMu.RLock()
+	defer bot.connMu.RUnlock()
+	return bot.state
+}
+
+// OnStateChange 连接状态变化回调, 回调在状态变化的协程中同步执行, 不应阻塞
+func (bot *Bot) OnStateChange(f func(from, to State)) (unsubscribe func()) {
+	return bot.subs.stateChange.add(f)
+}
+
+// setState 更新连接状态并触发回调
+func (bot *Bot) setState(s State) {
+	bot.connMu.Lock()
+	from := bot.state
+	bot.state = s
+	bot.connMu.Unlock()
+	if from == s {
+		return
+	}
+	bot.logger.Debug("state change", "from", from.String(), "to", s.String())
+	bot.notify(StateChangeEvent{From: from, To: s})
+}
+
+// isLoggedIn 当前连接是否已登录微信
+func (bot *Bot) isLoggedIn() bool {
+	return bot.State() == StateLoggedIn
+}
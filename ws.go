@@ -1,7 +1,10 @@
 package padchat
 
 import (
+	"bytes"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/json-iterator/go"
@@ -10,21 +13,51 @@ import (
 type WSConn struct {
 	sync.Mutex
 	*websocket.Conn
+	readTimeout time.Duration
 }
 
+// WriteJSON 发送 JSON 数据, 连接异常导致的发送失败返回的错误包含 ErrConnClosed
 func (c *WSConn) WriteJSON(v interface{}) error {
+	var buf bytes.Buffer
+	encoder := jsoniter.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
 	c.Lock()
 	defer c.Unlock()
-	w, err := c.NextWriter(websocket.TextMessage)
-	if err != nil {
-		return err
+	if err := c.WriteMessage(websocket.TextMessage, buf.Bytes()); err != nil {
+		return fmt.Errorf("%w: %v", ErrConnClosed, err)
 	}
-	encoder := jsoniter.NewEncoder(w)
-	encoder.SetEscapeHTML(false)
-	err1 := encoder.Encode(v)
-	err2 := w.Close()
-	if err1 != nil {
-		return err1
+	return nil
+}
+
+// setReadTimeout 设置读超时, 收到 pong 或数据时刷新, 需在开始读取前调用
+func (c *WSConn) setReadTimeout(t time.Duration) {
+	c.readTimeout = t
+	c.touch()
+	c.SetPongHandler(func(string) error {
+		c.touch()
+		return nil
+	})
+}
+
+// touch 刷新读超时
+func (c *WSConn) touch() {
+	if c.readTimeout > 0 {
+		c.SetReadDeadline(time.Now().Add(c.readTimeout))
+	}
+}
+
+// pingLoop 每隔 interval 发送一次 ping, 发送失败时返回
+func (c *WSConn) pingLoop(interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		err := c.WriteControl(websocket.PingMessage, nil, time.Now().Add(interval))
+		if err != nil {
+			return err
+		}
 	}
-	return err2
+	return nil
 }